@@ -0,0 +1,319 @@
+package grpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Principal is the authenticated caller of an RPC.
+type Principal struct {
+	Subject string
+	Roles   []string
+
+	// All claims carried by the token
+	Claims map[string]any
+}
+
+// Verifier validates bearer tokens and returns the principal they belong to.
+type Verifier interface {
+	Verify(ctx context.Context, token string) (*Principal, error)
+}
+
+// VerifierFunc adapts a function to the Verifier interface.
+type VerifierFunc func(ctx context.Context, token string) (*Principal, error)
+
+func (f VerifierFunc) Verify(ctx context.Context, token string) (*Principal, error) {
+	return f(ctx, token)
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a context carrying the principal.
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal injected by AuthInterceptor.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// AuthConfig controls how AuthInterceptor authenticates and authorizes calls.
+type AuthConfig struct {
+	Verifier Verifier
+
+	// Full method names that can be called without a token
+	PublicMethods []string
+
+	// Subjects or roles allowed to call each method.  "*" allows any
+	// authenticated principal.  Methods not listed are open to any
+	// authenticated principal.
+	AllowLists map[string][]string
+}
+
+// AuthInterceptor extracts the bearer token from the "authorization"
+// metadata, verifies it and injects the resulting Principal into the
+// context.  Fails with Unauthenticated if the token is missing or invalid
+// and PermissionDenied if the principal is not in the method's allow list.
+// Panics if the config has no usable Verifier.
+func AuthInterceptor(config AuthConfig) grpc.UnaryServerInterceptor {
+	config.mustValidate()
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+		ctx, err = config.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthInterceptor is the streaming counterpart of AuthInterceptor.
+func StreamAuthInterceptor(config AuthConfig) grpc.StreamServerInterceptor {
+	config.mustValidate()
+	return func(srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		ctx, err := config.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// mustValidate panics on configs that would fail (or panic) on every call.
+func (c *AuthConfig) mustValidate() {
+	switch v := c.Verifier.(type) {
+	case nil:
+		panic("auth: AuthConfig.Verifier is required")
+	case VerifierFunc:
+		if v == nil {
+			panic("auth: AuthConfig.Verifier is required")
+		}
+	case *HMACVerifier:
+		if v == nil || len(v.Secret) == 0 {
+			panic("auth: HMACVerifier needs a non empty secret")
+		}
+	}
+}
+
+func (c *AuthConfig) authenticate(ctx context.Context, method string) (context.Context, error) {
+	token := bearerToken(ctx)
+	if token == "" {
+		if slices.Contains(c.PublicMethods, method) {
+			return ctx, nil
+		}
+		return ctx, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	principal, err := c.Verifier.Verify(ctx, token)
+	if err != nil {
+		return ctx, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+	}
+	if principal == nil {
+		return ctx, status.Error(codes.Unauthenticated, "invalid token: no principal")
+	}
+	if allowed, ok := c.AllowLists[method]; ok && !principalAllowed(principal, allowed) {
+		return ctx, status.Errorf(codes.PermissionDenied, "%s is not allowed to call %s", principal.Subject, method)
+	}
+	return ContextWithPrincipal(ctx, principal), nil
+}
+
+func principalAllowed(principal *Principal, allowed []string) bool {
+	for _, entry := range allowed {
+		if entry == "*" || entry == principal.Subject || slices.Contains(principal.Roles, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+func bearerToken(ctx context.Context) string {
+	for _, value := range metadata.ValueFromIncomingContext(ctx, "authorization") {
+		if len(value) > 7 && strings.EqualFold(value[:7], "bearer ") {
+			return strings.TrimSpace(value[7:])
+		}
+	}
+	return ""
+}
+
+// TokenInterceptor attaches a bearer token obtained from tokenSource to every
+// outgoing unary call.  Calls are sent without a token if it is empty.
+func TokenInterceptor(tokenSource func(ctx context.Context) (string, error)) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := withBearerToken(ctx, tokenSource)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamTokenInterceptor is the streaming counterpart of TokenInterceptor.
+func StreamTokenInterceptor(tokenSource func(ctx context.Context) (string, error)) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+		method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := withBearerToken(ctx, tokenSource)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func withBearerToken(ctx context.Context, tokenSource func(ctx context.Context) (string, error)) (context.Context, error) {
+	token, err := tokenSource(ctx)
+	if err != nil {
+		return ctx, status.Errorf(codes.Unauthenticated, "failed to get token: %v", err)
+	}
+	if token == "" {
+		return ctx, nil
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token), nil
+}
+
+// contextServerStream overrides the context of a ServerStream.
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// HMACVerifier verifies HS256 signed JWTs with a shared secret.  Meant for
+// local development and tests rather than production identity providers.
+// The "sub" claim becomes the principal's subject and "roles" its roles.
+type HMACVerifier struct {
+	Secret []byte
+
+	// If set the "iss" and "aud" claims must match
+	Issuer   string
+	Audience string
+
+	// Allowed clock skew when checking "exp" and "nbf"
+	Leeway time.Duration
+}
+
+func NewHMACVerifier(secret []byte) *HMACVerifier {
+	return &HMACVerifier{Secret: secret}
+}
+
+var jwtEncoding = base64.RawURLEncoding
+
+var errEmptyHMACSecret = errors.New("empty HMAC secret")
+
+func (v *HMACVerifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	if len(v.Secret) == 0 {
+		return nil, errEmptyHMACSecret
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJwtPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported algorithm: %s", header.Alg)
+	}
+	signature, err := jwtEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, hmacSign(v.Secret, parts[0]+"."+parts[1])) {
+		return nil, errors.New("invalid signature")
+	}
+
+	var claims map[string]any
+	if err := decodeJwtPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(v.Leeway)) {
+		return nil, errors.New("token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token is not valid yet")
+	}
+	if v.Issuer != "" && claims["iss"] != v.Issuer {
+		return nil, errors.New("invalid issuer")
+	}
+	if v.Audience != "" && !audienceMatches(claims["aud"], v.Audience) {
+		return nil, errors.New("invalid audience")
+	}
+
+	principal := &Principal{Claims: claims}
+	principal.Subject, _ = claims["sub"].(string)
+	if roles, ok := claims["roles"].([]any); ok {
+		for _, role := range roles {
+			if r, ok := role.(string); ok {
+				principal.Roles = append(principal.Roles, r)
+			}
+		}
+	}
+	return principal, nil
+}
+
+// NewHMACToken creates an HS256 signed JWT with the given claims that can be
+// verified by an HMACVerifier with the same secret.
+func NewHMACToken(secret []byte, claims map[string]any) (string, error) {
+	if len(secret) == 0 {
+		return "", errEmptyHMACSecret
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := jwtEncoding.EncodeToString(header) + "." + jwtEncoding.EncodeToString(payload)
+	return signed + "." + jwtEncoding.EncodeToString(hmacSign(secret, signed)), nil
+}
+
+func hmacSign(secret []byte, data string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func decodeJwtPart(part string, out any) error {
+	data, err := jwtEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func audienceMatches(aud any, audience string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == audience
+	case []any:
+		for _, item := range a {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
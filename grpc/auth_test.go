@@ -0,0 +1,112 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestHMACVerifier(t *testing.T) {
+	secret := []byte("secret")
+	verifier := &HMACVerifier{Secret: secret, Issuer: "tests", Audience: "api"}
+
+	token, err := NewHMACToken(secret, map[string]any{
+		"sub": "alice", "roles": []string{"admin"}, "iss": "tests", "aud": []string{"api"},
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	assert.Nil(t, err)
+	principal, err := verifier.Verify(context.Background(), token)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", principal.Subject)
+	assert.Equal(t, []string{"admin"}, principal.Roles)
+
+	badTokens := []map[string]any{
+		{"sub": "alice", "iss": "tests", "aud": "api", "exp": time.Now().Add(-time.Minute).Unix()},
+		{"sub": "alice", "iss": "tests", "aud": "api", "nbf": time.Now().Add(time.Minute).Unix()},
+		{"sub": "alice", "iss": "other", "aud": "api"},
+		{"sub": "alice", "iss": "tests", "aud": "other"},
+	}
+	for _, claims := range badTokens {
+		token, _ := NewHMACToken(secret, claims)
+		_, err = verifier.Verify(context.Background(), token)
+		assert.NotNil(t, err, "%v", claims)
+	}
+
+	token, _ = NewHMACToken([]byte("wrong"), map[string]any{"sub": "alice", "iss": "tests", "aud": "api"})
+	_, err = verifier.Verify(context.Background(), token)
+	assert.EqualError(t, err, "invalid signature")
+	_, err = verifier.Verify(context.Background(), "not-a-token")
+	assert.NotNil(t, err)
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	secret := []byte("secret")
+	config := AuthConfig{
+		Verifier:      NewHMACVerifier(secret),
+		PublicMethods: []string{"/grpc.testing.TestService/StreamingOutputCall"},
+		AllowLists:    map[string][]string{"/grpc.testing.TestService/UnaryCall": {"admin", "bob"}},
+	}
+	var seen *Principal
+	svc := &testService{
+		unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+			seen, _ = PrincipalFromContext(ctx)
+			return &testpb.SimpleResponse{}, nil
+		},
+	}
+	var token string
+	conn := startTestServer(t, svc, []grpc.ServerOption{
+		grpc.UnaryInterceptor(AuthInterceptor(config)),
+		grpc.StreamInterceptor(StreamAuthInterceptor(config)),
+	}, grpc.WithUnaryInterceptor(TokenInterceptor(func(ctx context.Context) (string, error) {
+		return token, nil
+	})))
+	client := testpb.NewTestServiceClient(conn)
+
+	_, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Public methods need no token
+	stream, err := client.StreamingOutputCall(context.Background(), &testpb.StreamingOutputCallRequest{})
+	assert.Nil(t, err)
+	_, err = stream.Recv()
+	assert.NotEqual(t, codes.Unauthenticated, status.Code(err))
+
+	call := func(claims map[string]any) error {
+		token, err = NewHMACToken(secret, claims)
+		assert.Nil(t, err)
+		_, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+		return err
+	}
+	assert.Nil(t, call(map[string]any{"sub": "alice", "roles": []string{"admin"}}))
+	assert.Equal(t, "alice", seen.Subject)
+	assert.Nil(t, call(map[string]any{"sub": "bob"}))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call(map[string]any{"sub": "carol"})))
+	token = "garbage"
+	_, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestAuthConfigValidation(t *testing.T) {
+	assert.Panics(t, func() { AuthInterceptor(AuthConfig{}) })
+	assert.Panics(t, func() { StreamAuthInterceptor(AuthConfig{Verifier: NewHMACVerifier(nil)}) })
+
+	_, err := NewHMACVerifier(nil).Verify(context.Background(), "a.b.c")
+	assert.NotNil(t, err)
+	_, err = NewHMACToken(nil, map[string]any{"sub": "alice"})
+	assert.NotNil(t, err)
+
+	// Verifiers returning no principal are treated as rejecting the token
+	config := AuthConfig{Verifier: VerifierFunc(func(ctx context.Context, token string) (*Principal, error) {
+		return nil, nil
+	})}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token"))
+	_, err = AuthInterceptor(config)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, nil)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -0,0 +1,249 @@
+package grpc
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BreakerState is the state of a single circuit breaker.
+type BreakerState int
+
+const (
+	// Calls go through and failures are counted
+	BreakerClosed BreakerState = iota
+
+	// Calls fail fast until the cool-down has passed
+	BreakerOpen
+
+	// A limited number of trial calls go through to decide whether to close
+	// or open the breaker again
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreakerConfig controls when breakers trip and recover.
+type CircuitBreakerConfig struct {
+	// Fraction of failed calls (0 to 1) in a window that opens the breaker.
+	// Defaults to 0.5
+	FailureRatio float64
+
+	// Minimum calls in a window before the failure ratio is considered.
+	// Defaults to 10
+	MinRequests int
+
+	// Length of the window calls are counted over.  Counts are reset at the
+	// end of each window.  Defaults to 10s
+	Window time.Duration
+
+	// How long an open breaker fails calls before letting trial calls
+	// through.  Defaults to 5s
+	CoolDown time.Duration
+
+	// Number of trial calls let through while half-open.  The breaker closes
+	// once all of them succeed and opens again on the first failure.
+	// Defaults to 1
+	HalfOpenRequests int
+
+	// Status codes counted as failures.  Defaults to Unavailable,
+	// DeadlineExceeded, Internal and Unknown.
+	FailureCodes []codes.Code
+
+	// Called (outside any locks) whenever a breaker changes state, eg to
+	// log it
+	OnStateChange func(key string, from BreakerState, to BreakerState)
+}
+
+// CircuitBreaker keeps a breaker per target and method (keyed as
+// "target/package.Service/Method").  Calls made while a breaker is open fail
+// with codes.Unavailable carrying a RetryInfo detail with the remaining
+// cool-down.
+type CircuitBreaker struct {
+	config   CircuitBreakerConfig
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+type breaker struct {
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+
+	// Trial calls in flight and succeeded while half-open
+	probes         int
+	probeSuccesses int
+}
+
+type breakerTransition struct {
+	key      string
+	from, to BreakerState
+}
+
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	if config.FailureRatio <= 0 {
+		config.FailureRatio = 0.5
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 10
+	}
+	if config.Window <= 0 {
+		config.Window = 10 * time.Second
+	}
+	if config.CoolDown <= 0 {
+		config.CoolDown = 5 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	if config.FailureCodes == nil {
+		config.FailureCodes = []codes.Code{codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown}
+	}
+	return &CircuitBreaker{config: config, breakers: make(map[string]*breaker)}
+}
+
+// State returns the current state of the breaker for a key.  Unknown keys
+// are closed.
+func (cb *CircuitBreaker) State(key string) BreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if b, ok := cb.breakers[key]; ok {
+		// Report an expired cool-down as half-open even before the next call
+		if b.state == BreakerOpen && time.Since(b.openedAt) >= cb.config.CoolDown {
+			return BreakerHalfOpen
+		}
+		return b.state
+	}
+	return BreakerClosed
+}
+
+func (cb *CircuitBreaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		key := cc.Target() + method
+		probe, err := cb.allow(key)
+		if err != nil {
+			return err
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		cb.record(key, probe, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor guards the creation of streams.  Only failures to
+// open a stream are counted, not errors later in the stream.
+func (cb *CircuitBreaker) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+		method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		key := cc.Target() + method
+		probe, err := cb.allow(key)
+		if err != nil {
+			return nil, err
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		cb.record(key, probe, err)
+		return stream, err
+	}
+}
+
+// allow decides if a call can go through and whether it is a half-open trial.
+func (cb *CircuitBreaker) allow(key string) (probe bool, err error) {
+	var transitions []breakerTransition
+	defer func() { cb.notify(transitions) }()
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	now := time.Now()
+	b := cb.breakers[key]
+	if b == nil {
+		b = &breaker{windowStart: now}
+		cb.breakers[key] = b
+	}
+	switch b.state {
+	case BreakerClosed:
+		if now.Sub(b.windowStart) >= cb.config.Window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+		return false, nil
+	case BreakerOpen:
+		remaining := cb.config.CoolDown - now.Sub(b.openedAt)
+		if remaining > 0 {
+			return false, NewStatusError(codes.Unavailable, "circuit breaker is open for "+key, NewRetryInfo(remaining))
+		}
+		transitions = append(transitions, cb.setState(key, b, BreakerHalfOpen, now))
+	}
+	if b.probes >= cb.config.HalfOpenRequests {
+		return false, status.Errorf(codes.Unavailable, "circuit breaker is half-open for %s", key)
+	}
+	b.probes++
+	return true, nil
+}
+
+// record counts the outcome of a call.
+func (cb *CircuitBreaker) record(key string, probe bool, err error) {
+	var transitions []breakerTransition
+	defer func() { cb.notify(transitions) }()
+
+	failed := err != nil && slices.Contains(cb.config.FailureCodes, status.Code(err))
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	now := time.Now()
+	b := cb.breakers[key]
+	switch {
+	case probe && b.state == BreakerHalfOpen:
+		b.probes--
+		if failed {
+			transitions = append(transitions, cb.setState(key, b, BreakerOpen, now))
+		} else if b.probeSuccesses++; b.probeSuccesses >= cb.config.HalfOpenRequests {
+			transitions = append(transitions, cb.setState(key, b, BreakerClosed, now))
+		}
+	case !probe && b.state == BreakerClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= cb.config.MinRequests && float64(b.failures) >= cb.config.FailureRatio*float64(b.requests) {
+			transitions = append(transitions, cb.setState(key, b, BreakerOpen, now))
+		}
+	}
+}
+
+func (cb *CircuitBreaker) setState(key string, b *breaker, state BreakerState, now time.Time) breakerTransition {
+	transition := breakerTransition{key: key, from: b.state, to: state}
+	b.state = state
+	b.probes, b.probeSuccesses = 0, 0
+	switch state {
+	case BreakerOpen:
+		b.openedAt = now
+	case BreakerClosed:
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+	return transition
+}
+
+func (cb *CircuitBreaker) notify(transitions []breakerTransition) {
+	if cb.config.OnStateChange == nil {
+		return
+	}
+	for _, t := range transitions {
+		cb.config.OnStateChange(t.key, t.from, t.to)
+	}
+}
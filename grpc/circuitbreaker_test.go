@@ -0,0 +1,126 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+)
+
+const unaryCallKey = "bufnet/grpc.testing.TestService/UnaryCall"
+
+func TestCircuitBreakerTripsAndRecovers(t *testing.T) {
+	var failing atomic.Bool
+	var calls atomic.Int32
+	svc := &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		calls.Add(1)
+		if failing.Load() {
+			return nil, status.Error(codes.Unavailable, "down")
+		}
+		return &testpb.SimpleResponse{}, nil
+	}}
+
+	var mu sync.Mutex
+	var changes []string
+	cb := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		CoolDown:     50 * time.Millisecond,
+		OnStateChange: func(key string, from BreakerState, to BreakerState) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, unaryCallKey, key)
+			changes = append(changes, from.String()+"->"+to.String())
+		},
+	})
+	conn := startTestServer(t, svc, nil, grpc.WithUnaryInterceptor(cb.UnaryClientInterceptor()))
+	client := testpb.NewTestServiceClient(conn)
+	call := func() error {
+		_, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+		return err
+	}
+
+	// Failures are only considered after MinRequests calls
+	assert.Nil(t, call())
+	assert.Nil(t, call())
+	failing.Store(true)
+	assert.NotNil(t, call())
+	assert.Equal(t, BreakerClosed, cb.State(unaryCallKey))
+
+	// Two failures in four reach the ratio and calls then fail fast
+	assert.NotNil(t, call())
+	assert.Equal(t, BreakerOpen, cb.State(unaryCallKey))
+	before := calls.Load()
+	err := call()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	delay, ok := RetryDelay(err)
+	assert.True(t, ok)
+	assert.True(t, delay > 0 && delay <= 50*time.Millisecond)
+	assert.Equal(t, before, calls.Load())
+
+	// A failed trial call opens it again
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, BreakerHalfOpen, cb.State(unaryCallKey))
+	assert.NotNil(t, call())
+	assert.Equal(t, before+1, calls.Load())
+	assert.Equal(t, BreakerOpen, cb.State(unaryCallKey))
+
+	// A successful one closes it
+	failing.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	assert.Nil(t, call())
+	assert.Equal(t, BreakerClosed, cb.State(unaryCallKey))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}, changes)
+}
+
+func TestCircuitBreakerIgnoresNonFailures(t *testing.T) {
+	svc := &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		return nil, status.Error(codes.InvalidArgument, "bad request")
+	}}
+	cb := NewCircuitBreaker(CircuitBreakerConfig{MinRequests: 2})
+	conn := startTestServer(t, svc, nil, grpc.WithUnaryInterceptor(cb.UnaryClientInterceptor()))
+	client := testpb.NewTestServiceClient(conn)
+	for range 5 {
+		_, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	assert.Equal(t, BreakerClosed, cb.State(unaryCallKey))
+	assert.Equal(t, BreakerClosed, cb.State("unknown"))
+}
+
+func TestCircuitBreakerHalfOpenLimitsTrials(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{MinRequests: 1, CoolDown: time.Millisecond})
+	key := "target/method"
+	probe, err := cb.allow(key)
+	assert.Nil(t, err)
+	cb.record(key, probe, status.Error(codes.Unavailable, "down"))
+	assert.Equal(t, BreakerOpen, cb.breakers[key].state)
+
+	time.Sleep(2 * time.Millisecond)
+	probe, err = cb.allow(key)
+	assert.Nil(t, err)
+	assert.True(t, probe)
+
+	// Only one trial at a time
+	_, err = cb.allow(key)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	cb.record(key, probe, nil)
+	assert.Equal(t, BreakerClosed, cb.State(key))
+}
+
+func TestBreakerStateString(t *testing.T) {
+	assert.Equal(t, "closed", BreakerClosed.String())
+	assert.Equal(t, "open", BreakerOpen.String())
+	assert.Equal(t, "half-open", BreakerHalfOpen.String())
+}
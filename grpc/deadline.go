@@ -0,0 +1,191 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DeadlineConfig controls the deadlines DeadlineInterceptor enforces on
+// incoming calls.
+type DeadlineConfig struct {
+	// Timeout applied to calls that arrive without a deadline.  Zero leaves
+	// them without one (unless a maximum applies).
+	DefaultTimeout time.Duration
+
+	// Upper bound on the time any call may take.  Longer client deadlines are
+	// shortened to it.  Zero means no limit.
+	MaxTimeout time.Duration
+
+	// Per method (full method name) upper bounds overriding MaxTimeout
+	MethodTimeouts map[string]time.Duration
+}
+
+// DeadlineInterceptor bounds the deadline of every call by the configured
+// maximum and applies the default timeout to calls without a deadline.
+// The interceptor does not abandon handlers at the deadline - it waits for
+// them to return and only then substitutes DeadlineExceeded if the deadline
+// has passed, even if the handler ignored its context and succeeded.
+// Handlers should watch their context to stop early.
+func DeadlineInterceptor(config DeadlineConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+		ctx, cancel := config.withDeadline(ctx, info.FullMethod)
+		defer cancel()
+		resp, err = handler(ctx, req)
+		if err = deadlineError(ctx, err); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// StreamDeadlineInterceptor is the streaming counterpart of DeadlineInterceptor.
+func StreamDeadlineInterceptor(config DeadlineConfig) grpc.StreamServerInterceptor {
+	return func(srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		ctx, cancel := config.withDeadline(ss.Context(), info.FullMethod)
+		defer cancel()
+		err := handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+		return deadlineError(ctx, err)
+	}
+}
+
+// Timeout returns the maximum time a call to the method may take (zero if
+// unbounded).
+func (c *DeadlineConfig) Timeout(method string) time.Duration {
+	if timeout, ok := c.MethodTimeouts[method]; ok {
+		return timeout
+	}
+	return c.MaxTimeout
+}
+
+func (c *DeadlineConfig) withDeadline(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	maxTimeout := c.Timeout(method)
+	if _, ok := ctx.Deadline(); ok {
+		if maxTimeout <= 0 {
+			return ctx, func() {}
+		}
+		// WithTimeout keeps the earlier of the two deadlines
+		return context.WithTimeout(ctx, maxTimeout)
+	}
+	timeout := c.DefaultTimeout
+	if timeout <= 0 || (maxTimeout > 0 && maxTimeout < timeout) {
+		timeout = maxTimeout
+	}
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// deadlineError reports DeadlineExceeded for calls that overran their
+// deadline, including handlers that returned the plain context error.
+func deadlineError(ctx context.Context, err error) error {
+	if _, ok := status.FromError(err); ok && err != nil {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	}
+	return err
+}
+
+// DeadlineBudgetConfig controls how DeadlineBudgetInterceptor sets the
+// deadlines of outgoing calls.
+type DeadlineBudgetConfig struct {
+	// Timeout applied to calls whose context has no deadline.  Zero leaves
+	// them without one.
+	DefaultTimeout time.Duration
+
+	// Time held back from the remaining budget so the caller still has time
+	// to handle the response (or the failure) before its own deadline.
+	Reserve time.Duration
+
+	// Calls are failed immediately with DeadlineExceeded instead of being
+	// sent if less than this remains after the reserve.
+	MinBudget time.Duration
+}
+
+// DeadlineBudgetInterceptor propagates what is left of the caller's deadline
+// (eg that of the incoming call being handled) to outgoing calls, minus the
+// configured reserve.  Calls without a deadline get the default timeout and
+// calls without enough budget left fail fast without being sent.
+func DeadlineBudgetInterceptor(config DeadlineBudgetConfig) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, cancel, err := config.withBudget(ctx, method)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamDeadlineBudgetInterceptor is the streaming counterpart of
+// DeadlineBudgetInterceptor.  The deadline covers the whole stream.  As with
+// any gRPC stream, callers must either read it until RecvMsg fails or cancel
+// the context they opened it with, otherwise the derived context (and its
+// timer) is only released when the deadline passes.  Streams without server
+// streaming are released after their single response.
+func StreamDeadlineBudgetInterceptor(config DeadlineBudgetConfig) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+		method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, cancel, err := config.withBudget(ctx, method)
+		if err != nil {
+			return nil, err
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		return &cancelClientStream{ClientStream: stream, cancel: cancel, singleResponse: !desc.ServerStreams}, nil
+	}
+}
+
+func (c *DeadlineBudgetConfig) withBudget(ctx context.Context, method string) (context.Context, context.CancelFunc, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		if c.DefaultTimeout <= 0 {
+			return ctx, func() {}, nil
+		}
+		ctx, cancel := context.WithTimeout(ctx, c.DefaultTimeout)
+		return ctx, cancel, nil
+	}
+	budget := time.Until(deadline) - c.Reserve
+	if budget <= 0 || budget < c.MinBudget {
+		return ctx, nil, status.Errorf(codes.DeadlineExceeded, "not enough time left to call %s (%s)", method, budget)
+	}
+	if c.Reserve <= 0 {
+		return ctx, func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	return ctx, cancel, nil
+}
+
+// cancelClientStream releases the stream's context once the stream ends,
+// ie on the first error or after the only response of streams without
+// server streaming.
+type cancelClientStream struct {
+	grpc.ClientStream
+	cancel         context.CancelFunc
+	singleResponse bool
+}
+
+func (s *cancelClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil || s.singleResponse {
+		s.cancel()
+	}
+	return err
+}
@@ -0,0 +1,162 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+)
+
+// deadlineService reports the time left until the deadline of each call in
+// the response's username (or "none").
+func deadlineService(delay time.Duration) *testService {
+	return &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		time.Sleep(delay)
+		left := "none"
+		if deadline, ok := ctx.Deadline(); ok {
+			left = time.Until(deadline).String()
+		}
+		return &testpb.SimpleResponse{Username: left}, nil
+	}}
+}
+
+func timeLeft(t *testing.T, resp *testpb.SimpleResponse) time.Duration {
+	left, err := time.ParseDuration(resp.Username)
+	assert.Nil(t, err)
+	return left
+}
+
+func TestDeadlineInterceptorDefaultsAndCaps(t *testing.T) {
+	config := DeadlineConfig{
+		DefaultTimeout: time.Second,
+		MaxTimeout:     5 * time.Second,
+		MethodTimeouts: map[string]time.Duration{"/grpc.testing.TestService/UnaryCall": 2 * time.Second},
+	}
+	conn := startTestServer(t, deadlineService(0), []grpc.ServerOption{grpc.UnaryInterceptor(DeadlineInterceptor(config))})
+	client := testpb.NewTestServiceClient(conn)
+
+	resp, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Nil(t, err)
+	left := timeLeft(t, resp)
+	assert.True(t, left > 500*time.Millisecond && left <= time.Second, left)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	resp, err = client.UnaryCall(ctx, &testpb.SimpleRequest{})
+	assert.Nil(t, err)
+	left = timeLeft(t, resp)
+	assert.True(t, left > time.Second && left <= 2*time.Second, left)
+
+	assert.Equal(t, 2*time.Second, config.Timeout("/grpc.testing.TestService/UnaryCall"))
+	assert.Equal(t, 5*time.Second, config.Timeout("/other"))
+}
+
+func TestDeadlineInterceptorNoLimits(t *testing.T) {
+	conn := startTestServer(t, deadlineService(0), []grpc.ServerOption{grpc.UnaryInterceptor(DeadlineInterceptor(DeadlineConfig{}))})
+	resp, err := testpb.NewTestServiceClient(conn).UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, "none", resp.Username)
+}
+
+func TestDeadlineInterceptorOverrun(t *testing.T) {
+	config := DeadlineConfig{DefaultTimeout: 20 * time.Millisecond}
+	conn := startTestServer(t, deadlineService(100*time.Millisecond), []grpc.ServerOption{grpc.UnaryInterceptor(DeadlineInterceptor(config))})
+	_, err := testpb.NewTestServiceClient(conn).UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestDeadlineInterceptorWaitsForHandler(t *testing.T) {
+	interceptor := DeadlineInterceptor(DeadlineConfig{DefaultTimeout: 20 * time.Millisecond})
+	info := &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		// Ignores its context
+		time.Sleep(100 * time.Millisecond)
+		return &testpb.SimpleResponse{}, nil
+	}
+
+	// The error is only substituted once the handler returns
+	start := time.Now()
+	resp, err := interceptor(context.Background(), &testpb.SimpleRequest{}, info, handler)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestDeadlineBudgetInterceptor(t *testing.T) {
+	budget := DeadlineBudgetConfig{DefaultTimeout: 3 * time.Second, Reserve: time.Second, MinBudget: 500 * time.Millisecond}
+	conn := startTestServer(t, deadlineService(0), nil, grpc.WithUnaryInterceptor(DeadlineBudgetInterceptor(budget)))
+	client := testpb.NewTestServiceClient(conn)
+
+	// Calls without a deadline get the default
+	resp, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Nil(t, err)
+	left := timeLeft(t, resp)
+	assert.True(t, left > 2*time.Second && left <= 3*time.Second, left)
+
+	// The reserve is held back from the remaining budget
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+	resp, err = client.UnaryCall(ctx, &testpb.SimpleRequest{})
+	assert.Nil(t, err)
+	left = timeLeft(t, resp)
+	assert.True(t, left > 2*time.Second && left <= 3*time.Second, left)
+
+	// Not enough budget left to bother calling
+	ctx, cancel = context.WithTimeout(context.Background(), 1200*time.Millisecond)
+	defer cancel()
+	_, err = client.UnaryCall(ctx, &testpb.SimpleRequest{})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestStreamDeadlineBudgetInterceptor(t *testing.T) {
+	budget := DeadlineBudgetConfig{DefaultTimeout: time.Second}
+	conn := startTestServer(t, &testService{}, nil, grpc.WithStreamInterceptor(StreamDeadlineBudgetInterceptor(budget)))
+	stream, err := testpb.NewTestServiceClient(conn).StreamingOutputCall(context.Background(), &testpb.StreamingOutputCallRequest{
+		ResponseParameters: []*testpb.ResponseParameters{{}, {}},
+	})
+	assert.Nil(t, err)
+	count := 0
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+		count++
+	}
+	assert.Equal(t, 2, count)
+}
+
+func TestStreamDeadlineBudgetReleasesSingleResponseStreams(t *testing.T) {
+	budget := DeadlineBudgetConfig{DefaultTimeout: time.Minute}
+	var streamCtx context.Context
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		streamCtx = ctx
+		return &fakeClientStream{}, nil
+	}
+	interceptor := StreamDeadlineBudgetInterceptor(budget)
+
+	// Client streaming calls are released after their response
+	stream, err := interceptor(context.Background(), &grpc.StreamDesc{ClientStreams: true}, nil, "/svc/Method", streamer)
+	assert.Nil(t, err)
+	assert.Nil(t, stream.RecvMsg(nil))
+	assert.NotNil(t, streamCtx.Err())
+
+	// Server streaming calls stay open until they end
+	stream, err = interceptor(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, "/svc/Method", streamer)
+	assert.Nil(t, err)
+	assert.Nil(t, stream.RecvMsg(nil))
+	assert.Nil(t, streamCtx.Err())
+}
+
+// fakeClientStream is a ClientStream whose RecvMsg always succeeds.
+type fakeClientStream struct {
+	grpc.ClientStream
+}
+
+func (s *fakeClientStream) RecvMsg(m interface{}) error {
+	return nil
+}
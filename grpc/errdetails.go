@@ -0,0 +1,125 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// NewStatusError creates a status error carrying the given details (eg the
+// errdetails messages created by the helpers below).
+func NewStatusError(code codes.Code, msg string, details ...protoiface.MessageV1) error {
+	st := status.New(code, msg)
+	if len(details) > 0 {
+		if withDetails, err := st.WithDetails(details...); err == nil {
+			st = withDetails
+		}
+	}
+	return st.Err()
+}
+
+// NewBadRequestError creates an InvalidArgument error with field violations.
+func NewBadRequestError(msg string, violations ...*errdetails.BadRequest_FieldViolation) error {
+	return NewStatusError(codes.InvalidArgument, msg, &errdetails.BadRequest{FieldViolations: violations})
+}
+
+func NewFieldViolation(field string, description string) *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{Field: field, Description: description}
+}
+
+func NewErrorInfo(reason string, domain string, metadata map[string]string) *errdetails.ErrorInfo {
+	return &errdetails.ErrorInfo{Reason: reason, Domain: domain, Metadata: metadata}
+}
+
+func NewRetryInfo(delay time.Duration) *errdetails.RetryInfo {
+	return &errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}
+}
+
+func NewResourceInfo(resourceType string, name string, owner string, description string) *errdetails.ResourceInfo {
+	return &errdetails.ResourceInfo{ResourceType: resourceType, ResourceName: name, Owner: owner, Description: description}
+}
+
+// ErrorDetail returns the first detail of type T attached to a status error.
+//
+//	if info, ok := ErrorDetail[*errdetails.ErrorInfo](err); ok { ... }
+func ErrorDetail[T proto.Message](err error) (out T, found bool) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return
+	}
+	for _, detail := range st.Details() {
+		if d, ok := detail.(T); ok {
+			return d, true
+		}
+	}
+	return
+}
+
+// FieldViolations returns the BadRequest field violations in a status error.
+func FieldViolations(err error) []*errdetails.BadRequest_FieldViolation {
+	if badRequest, ok := ErrorDetail[*errdetails.BadRequest](err); ok {
+		return badRequest.FieldViolations
+	}
+	return nil
+}
+
+// RetryDelay returns the delay from a RetryInfo detail in a status error.
+func RetryDelay(err error) (time.Duration, bool) {
+	if retryInfo, ok := ErrorDetail[*errdetails.RetryInfo](err); ok && retryInfo.RetryDelay != nil {
+		return retryInfo.RetryDelay.AsDuration(), true
+	}
+	return 0, false
+}
+
+// QuotaExceededError is implemented by errors reporting an exceeded quota (eg
+// storage.QuotaError) so they can be mapped without depending on where they
+// are defined.
+type QuotaExceededError interface {
+	error
+
+	// QuotaViolation returns the subject (eg an entity id) and a description
+	// of the limit that was exceeded
+	QuotaViolation() (subject string, description string)
+}
+
+// ToStatusError converts common Go errors into status errors with the
+// matching code.  Errors that already carry a status (and anything that is
+// not recognized) are returned as is.
+func ToStatusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var quotaErr QuotaExceededError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, os.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, os.ErrExist):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, os.ErrPermission):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.As(err, &quotaErr):
+		subject, description := quotaErr.QuotaViolation()
+		return NewStatusError(codes.ResourceExhausted, err.Error(), &errdetails.QuotaFailure{
+			Violations: []*errdetails.QuotaFailure_Violation{{
+				Subject:     subject,
+				Description: description,
+			}},
+		})
+	}
+	return err
+}
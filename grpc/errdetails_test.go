@@ -0,0 +1,87 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/panyam/goutils/storage"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorDetails(t *testing.T) {
+	err := NewBadRequestError("invalid request",
+		NewFieldViolation("name", "must not be empty"),
+		NewFieldViolation("age", "must be positive"))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	violations := FieldViolations(err)
+	assert.Equal(t, 2, len(violations))
+	assert.Equal(t, "age", violations[1].Field)
+
+	err = NewStatusError(codes.Unavailable, "try later",
+		NewRetryInfo(3*time.Second),
+		NewErrorInfo("OVERLOADED", "example.com", map[string]string{"region": "us"}),
+		NewResourceInfo("book", "books/1", "alice", "the book"))
+	delay, ok := RetryDelay(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, delay)
+	info, ok := ErrorDetail[*errdetails.ErrorInfo](err)
+	assert.True(t, ok)
+	assert.Equal(t, "us", info.Metadata["region"])
+	resource, ok := ErrorDetail[*errdetails.ResourceInfo](err)
+	assert.True(t, ok)
+	assert.Equal(t, "books/1", resource.ResourceName)
+
+	_, ok = ErrorDetail[*errdetails.BadRequest](err)
+	assert.False(t, ok)
+	_, ok = RetryDelay(errors.New("plain"))
+	assert.False(t, ok)
+}
+
+func TestToStatusError(t *testing.T) {
+	fs := storage.NewFileStorage(t.TempDir(), storage.WithQuota(storage.Quota{MaxArtifactSize: 1}))
+	_, loadErr := fs.ReadArtifactFile("missing", "metadata")
+	quotaErr := fs.SaveArtifact("e1", "metadata", &testpb.Payload{Body: []byte("too big")})
+
+	for _, tc := range []struct {
+		err  error
+		code codes.Code
+	}{
+		{context.Canceled, codes.Canceled},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), codes.DeadlineExceeded},
+		{loadErr, codes.NotFound},
+		{os.ErrExist, codes.AlreadyExists},
+		{os.ErrPermission, codes.PermissionDenied},
+		{quotaErr, codes.ResourceExhausted},
+		{status.Error(codes.Aborted, "aborted"), codes.Aborted},
+		{errors.New("unknown"), codes.Unknown},
+	} {
+		assert.Equal(t, tc.code, status.Code(ToStatusError(tc.err)), "%v", tc.err)
+	}
+	assert.Nil(t, ToStatusError(nil))
+	failure, ok := ErrorDetail[*errdetails.QuotaFailure](ToStatusError(quotaErr))
+	assert.True(t, ok)
+	assert.Equal(t, "e1", failure.Violations[0].Subject)
+	assert.Equal(t, "MaxArtifactSize", failure.Violations[0].Description)
+}
+
+func TestErrorLoggerMapsErrors(t *testing.T) {
+	logs := captureLog(t)
+	svc := &testService{
+		unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+			return nil, fmt.Errorf("loading: %w", os.ErrNotExist)
+		},
+	}
+	conn := startTestServer(t, svc, []grpc.ServerOption{grpc.UnaryInterceptor(ErrorLogger())})
+	_, err := testpb.NewTestServiceClient(conn).UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.NotContains(t, logs.String(), "reporting it")
+}
@@ -3,15 +3,136 @@ package grpc
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"runtime/debug"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-func ErrorLogger( /* Add configs here */ ) grpc.UnaryServerInterceptor {
+// ErrorReport describes a failed or panicking request reported by ErrorLogger.
+type ErrorReport struct {
+	// Full method name of the RPC, eg /package.Service/Method
+	Method string
+
+	// Id set by RequestIdInterceptor, if any
+	RequestId string
+
+	// Code and error the request failed with.  Panics are reported as
+	// codes.Internal.
+	Code codes.Code
+	Err  error
+
+	// Value recovered from the handler if it panicked
+	Panic any
+
+	// Stack trace of the panic (if stack traces are enabled)
+	Stack []byte
+
+	// The (redacted) request if request payloads are enabled.  Always nil
+	// for streaming RPCs.
+	Request any
+}
+
+// ErrorReporter receives errors and panics from ErrorLogger, eg to forward
+// them to an external error reporting service.
+type ErrorReporter func(ctx context.Context, report *ErrorReport)
+
+// ErrorLoggerOption customizes ErrorLogger and StreamErrorLogger.
+type ErrorLoggerOption func(c *errorLoggerConfig)
+
+type errorLoggerConfig struct {
+	logger        *slog.Logger
+	reportedCodes map[codes.Code]bool
+	reporter      ErrorReporter
+	stackTraces   bool
+	logPayloads   bool
+	redact        func(req any) any
+	repanic       bool
+	errorMapper   func(err error) error
+}
+
+// WithLogger sets the logger errors are written to.  Defaults to slog.Default().
+func WithLogger(logger *slog.Logger) ErrorLoggerOption {
+	return func(c *errorLoggerConfig) {
+		c.logger = logger
+	}
+}
+
+// WithReportedCodes sets the status codes that are logged and reported.
+// Defaults to codes.Unknown and codes.Internal.  Panics are always reported.
+func WithReportedCodes(reported ...codes.Code) ErrorLoggerOption {
+	return func(c *errorLoggerConfig) {
+		c.reportedCodes = make(map[codes.Code]bool)
+		for _, code := range reported {
+			c.reportedCodes[code] = true
+		}
+	}
+}
+
+// WithReporter sets a hook that is called for every reported error or panic.
+func WithReporter(reporter ErrorReporter) ErrorLoggerOption {
+	return func(c *errorLoggerConfig) {
+		c.reporter = reporter
+	}
+}
+
+// WithStackTrace toggles including stack traces when panics are logged and
+// reported.  Enabled by default.
+func WithStackTrace(enabled bool) ErrorLoggerOption {
+	return func(c *errorLoggerConfig) {
+		c.stackTraces = enabled
+	}
+}
+
+// WithRequestPayloads includes request payloads when unary errors are logged
+// and reported.  The request is passed through redact first so sensitive
+// fields can be removed.  Defaults to DefaultRedactor.RedactPayload if nil.
+func WithRequestPayloads(redact func(req any) any) ErrorLoggerOption {
+	return func(c *errorLoggerConfig) {
+		c.logPayloads = true
+		c.redact = redact
+	}
+}
+
+// WithRepanic re-panics with the original value after a panic has been logged
+// and reported instead of returning an Internal error.  Useful in development
+// to fail loudly.
+func WithRepanic(enabled bool) ErrorLoggerOption {
+	return func(c *errorLoggerConfig) {
+		c.repanic = enabled
+	}
+}
+
+// WithErrorMapper sets how errors returned by handlers are converted before
+// being reported and returned to the client.  Defaults to ToStatusError so
+// that common Go errors (eg os.ErrNotExist) map to the right status codes.
+// Passing nil returns errors unchanged.
+func WithErrorMapper(mapper func(err error) error) ErrorLoggerOption {
+	return func(c *errorLoggerConfig) {
+		c.errorMapper = mapper
+	}
+}
+
+func newErrorLoggerConfig(opts []ErrorLoggerOption) *errorLoggerConfig {
+	c := &errorLoggerConfig{
+		reportedCodes: map[codes.Code]bool{codes.Unknown: true, codes.Internal: true},
+		stackTraces:   true,
+		errorMapper:   ToStatusError,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.logger == nil {
+		c.logger = slog.Default()
+	}
+	return c
+}
+
+func ErrorLogger(opts ...ErrorLoggerOption) grpc.UnaryServerInterceptor {
+	config := newErrorLoggerConfig(opts)
 	return func(ctx context.Context,
 		req interface{},
 		info *grpc.UnaryServerInfo,
@@ -20,19 +141,113 @@ func ErrorLogger( /* Add configs here */ ) grpc.UnaryServerInterceptor {
 		onPanic := func() {
 			r := recover()
 			if r != nil {
-				err = status.Errorf(codes.Internal, "panic: %s", r)
-				errmsg := fmt.Sprintf("[PANIC] %s\n\n%s", r, string(debug.Stack()))
-				log.Println(errmsg)
+				err = config.panicError(ctx, info.FullMethod, req, r)
 			}
 		}
 		defer onPanic()
 
 		resp, err = handler(ctx, req)
-		errCode := status.Code(err)
-		if errCode == codes.Unknown || errCode == codes.Internal {
-			log.Println("Request handler returned an internal error - reporting it")
-			return
+		err = withRequestInfo(ctx, config.mapError(err))
+		config.reportError(ctx, info.FullMethod, req, err)
+		return
+	}
+}
+
+// StreamErrorLogger is the streaming counterpart of ErrorLogger.  Panics in
+// stream handlers are recovered and returned as codes.Internal errors.
+func StreamErrorLogger(opts ...ErrorLoggerOption) grpc.StreamServerInterceptor {
+	config := newErrorLoggerConfig(opts)
+	return func(srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+
+		onPanic := func() {
+			r := recover()
+			if r != nil {
+				err = config.panicError(ss.Context(), info.FullMethod, nil, r)
+			}
 		}
+		defer onPanic()
+
+		err = handler(srv, ss)
+		err = withRequestInfo(ss.Context(), config.mapError(err))
+		config.reportError(ss.Context(), info.FullMethod, nil, err)
 		return
 	}
 }
+
+// panicError logs and reports a recovered panic and converts it into an
+// Internal status error.
+func (c *errorLoggerConfig) panicError(ctx context.Context, method string, req any, r any) error {
+	err := withRequestInfo(ctx, status.Errorf(codes.Internal, "panic: %s", r))
+	report := &ErrorReport{Method: method, Code: codes.Internal, Err: err, Panic: r, Request: c.payload(req)}
+	attrs := []any{"method", method}
+	if id, ok := RequestIdFromContext(ctx); ok {
+		report.RequestId = id
+		attrs = append(attrs, "request_id", id)
+	}
+	if c.stackTraces {
+		report.Stack = debug.Stack()
+		attrs = append(attrs, "stack", string(report.Stack))
+	}
+	if report.Request != nil {
+		attrs = append(attrs, "request", formatPayload(report.Request))
+	}
+	c.logger.ErrorContext(ctx, fmt.Sprintf("[PANIC] %s", r), attrs...)
+	if c.reporter != nil {
+		c.reporter(ctx, report)
+	}
+	if c.repanic {
+		panic(r)
+	}
+	return err
+}
+
+// reportError logs and reports errors whose codes are in the reported set.
+func (c *errorLoggerConfig) reportError(ctx context.Context, method string, req any, err error) {
+	if err == nil {
+		return
+	}
+	errCode := status.Code(err)
+	if !c.reportedCodes[errCode] {
+		return
+	}
+	report := &ErrorReport{Method: method, Code: errCode, Err: err, Request: c.payload(req)}
+	attrs := []any{"method", method, "code", errCode.String(), "error", err.Error()}
+	if id, ok := RequestIdFromContext(ctx); ok {
+		report.RequestId = id
+		attrs = append(attrs, "request_id", id)
+	}
+	if report.Request != nil {
+		attrs = append(attrs, "request", formatPayload(report.Request))
+	}
+	c.logger.ErrorContext(ctx, "Request handler returned an error - reporting it", attrs...)
+	if c.reporter != nil {
+		c.reporter(ctx, report)
+	}
+}
+
+func (c *errorLoggerConfig) mapError(err error) error {
+	if err == nil || c.errorMapper == nil {
+		return err
+	}
+	return c.errorMapper(err)
+}
+
+func (c *errorLoggerConfig) payload(req any) any {
+	if !c.logPayloads || req == nil {
+		return nil
+	}
+	if c.redact != nil {
+		return c.redact(req)
+	}
+	return DefaultRedactor.RedactPayload(req)
+}
+
+func formatPayload(payload any) string {
+	if msg, ok := payload.(protoreflect.ProtoMessage); ok {
+		return DefaultProtoFormat(msg)
+	}
+	return fmt.Sprintf("%v", payload)
+}
@@ -0,0 +1,181 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// testService is a TestService whose handlers can be swapped out per test
+type testService struct {
+	testpb.UnimplementedTestServiceServer
+	unary     func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error)
+	streamOut func(req *testpb.StreamingOutputCallRequest, stream testpb.TestService_StreamingOutputCallServer) error
+}
+
+func (s *testService) UnaryCall(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	if s.unary == nil {
+		return &testpb.SimpleResponse{Payload: req.Payload}, nil
+	}
+	return s.unary(ctx, req)
+}
+
+func (s *testService) StreamingOutputCall(req *testpb.StreamingOutputCallRequest, stream testpb.TestService_StreamingOutputCallServer) error {
+	if s.streamOut == nil {
+		for range req.ResponseParameters {
+			if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: req.Payload}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return s.streamOut(req, stream)
+}
+
+// startTestServer serves svc over an in-memory connection and returns a
+// connected client.  Everything is cleaned up at the end of the test.
+func startTestServer(t *testing.T, svc testpb.TestServiceServer, opts []grpc.ServerOption, dialOpts ...grpc.DialOption) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(opts...)
+	testpb.RegisterTestServiceServer(server, svc)
+	go server.Serve(lis)
+
+	dialOpts = append(dialOpts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.DialContext(context.Background(), "bufnet", dialOpts...)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+	})
+	return conn
+}
+
+// captureLog redirects the standard logger for the duration of a test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+	return &buf
+}
+
+func TestErrorLoggerRecoversPanics(t *testing.T) {
+	logs := captureLog(t)
+	svc := &testService{
+		unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+			panic("unary boom")
+		},
+		streamOut: func(req *testpb.StreamingOutputCallRequest, stream testpb.TestService_StreamingOutputCallServer) error {
+			stream.Send(&testpb.StreamingOutputCallResponse{})
+			panic("stream boom")
+		},
+	}
+	conn := startTestServer(t, svc, []grpc.ServerOption{
+		grpc.UnaryInterceptor(ErrorLogger()),
+		grpc.StreamInterceptor(StreamErrorLogger()),
+	})
+	client := testpb.NewTestServiceClient(conn)
+
+	_, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "unary boom")
+
+	stream, err := client.StreamingOutputCall(context.Background(), &testpb.StreamingOutputCallRequest{})
+	assert.Nil(t, err)
+	_, err = stream.Recv()
+	assert.Nil(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "stream boom")
+
+	assert.Contains(t, logs.String(), "[PANIC] unary boom")
+	assert.Contains(t, logs.String(), "[PANIC] stream boom")
+	assert.Contains(t, logs.String(), "goroutine")
+}
+
+func TestStreamErrorLoggerReportsInternalErrors(t *testing.T) {
+	logs := captureLog(t)
+	svc := &testService{
+		streamOut: func(req *testpb.StreamingOutputCallRequest, stream testpb.TestService_StreamingOutputCallServer) error {
+			return status.Error(codes.Internal, "broken")
+		},
+	}
+	conn := startTestServer(t, svc, []grpc.ServerOption{grpc.StreamInterceptor(StreamErrorLogger())})
+	stream, err := testpb.NewTestServiceClient(conn).StreamingOutputCall(context.Background(), &testpb.StreamingOutputCallRequest{})
+	assert.Nil(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, logs.String(), "reporting it")
+}
+
+func TestErrorLoggerOptions(t *testing.T) {
+	var logs bytes.Buffer
+	var reports []*ErrorReport
+	svc := &testService{
+		unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+			if req.ResponseSize > 0 {
+				panic("boom")
+			}
+			return nil, status.Error(codes.NotFound, "missing")
+		},
+	}
+	conn := startTestServer(t, svc, []grpc.ServerOption{
+		grpc.UnaryInterceptor(ErrorLogger(
+			WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+			WithReportedCodes(codes.NotFound),
+			WithStackTrace(false),
+			WithReporter(func(ctx context.Context, report *ErrorReport) {
+				reports = append(reports, report)
+			}),
+			WithRequestPayloads(func(req any) any {
+				redacted := proto.Clone(req.(proto.Message)).(*testpb.SimpleRequest)
+				redacted.Payload = nil
+				return redacted
+			}),
+		)),
+	})
+	client := testpb.NewTestServiceClient(conn)
+
+	_, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte("secret")}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{ResponseSize: 1, Payload: &testpb.Payload{Body: []byte("secret")}})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	assert.Equal(t, 2, len(reports))
+	assert.Equal(t, codes.NotFound, reports[0].Code)
+	assert.Equal(t, "/grpc.testing.TestService/UnaryCall", reports[0].Method)
+	assert.Nil(t, reports[0].Panic)
+	assert.Equal(t, "boom", reports[1].Panic)
+	assert.Nil(t, reports[1].Stack)
+	assert.Nil(t, reports[1].Request.(*testpb.SimpleRequest).Payload)
+
+	assert.Contains(t, logs.String(), "response_size")
+	assert.NotContains(t, logs.String(), "goroutine")
+	assert.NotContains(t, logs.String(), base64.StdEncoding.EncodeToString([]byte("secret")))
+}
+
+func TestErrorLoggerRepanic(t *testing.T) {
+	interceptor := ErrorLogger(WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))), WithRepanic(true))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	assert.PanicsWithValue(t, "boom", func() {
+		interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+			panic("boom")
+		})
+	})
+}
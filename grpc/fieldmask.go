@@ -0,0 +1,215 @@
+package grpc
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// ValidateFieldMask checks that every path in a mask refers to a field of
+// the message.  Paths are "." separated proto field names and only singular
+// message fields can have sub paths.  Returns an InvalidArgument error with
+// a field violation for each invalid path.
+func ValidateFieldMask(mask *fieldmaskpb.FieldMask, desc protoreflect.MessageDescriptor) error {
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, path := range mask.GetPaths() {
+		if err := validateFieldPath(path, desc); err != nil {
+			violations = append(violations, NewFieldViolation("update_mask", err.Error()))
+		}
+	}
+	if len(violations) > 0 {
+		return NewBadRequestError(fmt.Sprintf("invalid field mask for %s", desc.FullName()), violations...)
+	}
+	return nil
+}
+
+func validateFieldPath(path string, desc protoreflect.MessageDescriptor) error {
+	if path == "" {
+		return fmt.Errorf("empty path")
+	}
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		fd := desc.Fields().ByName(protoreflect.Name(part))
+		if fd == nil {
+			return fmt.Errorf("%s: %s has no field named %s", path, desc.FullName(), part)
+		}
+		if i < len(parts)-1 {
+			if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+				return fmt.Errorf("%s: %s is not a singular message field", path, part)
+			}
+			desc = fd.Message()
+		}
+	}
+	return nil
+}
+
+// ApplyFieldMask copies the fields in the mask from src to dst.  Fields in
+// the mask that are not set in src are cleared in dst, so this implements
+// the usual PATCH semantics.  An empty mask replaces dst with src entirely.
+func ApplyFieldMask(mask *fieldmaskpb.FieldMask, src proto.Message, dst proto.Message) error {
+	srcMsg, dstMsg := src.ProtoReflect(), dst.ProtoReflect()
+	if srcMsg.Descriptor().FullName() != dstMsg.Descriptor().FullName() {
+		return fmt.Errorf("cannot apply mask from %s to %s", srcMsg.Descriptor().FullName(), dstMsg.Descriptor().FullName())
+	}
+	if err := ValidateFieldMask(mask, dstMsg.Descriptor()); err != nil {
+		return err
+	}
+	if len(mask.GetPaths()) == 0 {
+		proto.Reset(dst)
+		proto.Merge(dst, src)
+		return nil
+	}
+	// Copy from a clone so dst never shares lists, maps or messages with src
+	applyFieldMaskTree(newFieldMaskTree(mask.GetPaths()), proto.Clone(src).ProtoReflect(), dstMsg)
+	return nil
+}
+
+func applyFieldMaskTree(tree fieldMaskTree, src protoreflect.Message, dst protoreflect.Message) {
+	for name, subtree := range tree {
+		fd := dst.Descriptor().Fields().ByName(name)
+		if len(subtree) == 0 {
+			if src.Has(fd) {
+				dst.Set(fd, src.Get(fd))
+			} else {
+				dst.Clear(fd)
+			}
+		} else if src.Has(fd) || dst.Has(fd) {
+			applyFieldMaskTree(subtree, src.Get(fd).Message(), dst.Mutable(fd).Message())
+		}
+	}
+}
+
+// TrimToFieldMask clears all fields of msg that are not in the mask, eg to
+// return only the requested fields in a response.
+func TrimToFieldMask(mask *fieldmaskpb.FieldMask, msg proto.Message) error {
+	m := msg.ProtoReflect()
+	if err := ValidateFieldMask(mask, m.Descriptor()); err != nil {
+		return err
+	}
+	trimToFieldMaskTree(newFieldMaskTree(mask.GetPaths()), m)
+	return nil
+}
+
+func trimToFieldMaskTree(tree fieldMaskTree, m protoreflect.Message) {
+	var fields []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+	for _, fd := range fields {
+		subtree, ok := tree[fd.Name()]
+		if !ok {
+			m.Clear(fd)
+		} else if len(subtree) > 0 {
+			trimToFieldMaskTree(subtree, m.Mutable(fd).Message())
+		}
+	}
+}
+
+// DiffFieldMask returns a mask with the paths of all fields that differ
+// between two messages of the same type.  Singular message fields set in
+// both are compared field by field, everything else is compared as a whole.
+func DiffFieldMask(a proto.Message, b proto.Message) (*fieldmaskpb.FieldMask, error) {
+	am, bm := a.ProtoReflect(), b.ProtoReflect()
+	if am.Descriptor().FullName() != bm.Descriptor().FullName() {
+		return nil, fmt.Errorf("cannot diff %s with %s", am.Descriptor().FullName(), bm.Descriptor().FullName())
+	}
+	var paths []string
+	diffFieldPaths(am, bm, "", &paths)
+	sort.Strings(paths)
+	return &fieldmaskpb.FieldMask{Paths: paths}, nil
+}
+
+func diffFieldPaths(a protoreflect.Message, b protoreflect.Message, prefix string, paths *[]string) {
+	fields := a.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		hasA, hasB := a.Has(fd), b.Has(fd)
+		if !hasA && !hasB {
+			continue
+		}
+		path := prefix + string(fd.Name())
+		if hasA && hasB && fd.Message() != nil && !fd.IsList() && !fd.IsMap() {
+			diffFieldPaths(a.Get(fd).Message(), b.Get(fd).Message(), path+".", paths)
+		} else if hasA != hasB || !fieldValuesEqual(fd, a.Get(fd), b.Get(fd)) {
+			*paths = append(*paths, path)
+		}
+	}
+}
+
+// fieldValuesEqual compares two values of the same field.
+func fieldValuesEqual(fd protoreflect.FieldDescriptor, a protoreflect.Value, b protoreflect.Value) bool {
+	switch {
+	case fd.IsList():
+		la, lb := a.List(), b.List()
+		if la.Len() != lb.Len() {
+			return false
+		}
+		for i := 0; i < la.Len(); i++ {
+			if !singularValuesEqual(fd, la.Get(i), lb.Get(i)) {
+				return false
+			}
+		}
+		return true
+	case fd.IsMap():
+		ma, mb := a.Map(), b.Map()
+		if ma.Len() != mb.Len() {
+			return false
+		}
+		equal := true
+		ma.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			equal = mb.Has(key) && singularValuesEqual(fd.MapValue(), value, mb.Get(key))
+			return equal
+		})
+		return equal
+	default:
+		return singularValuesEqual(fd, a, b)
+	}
+}
+
+func singularValuesEqual(fd protoreflect.FieldDescriptor, a protoreflect.Value, b protoreflect.Value) bool {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return proto.Equal(a.Message().Interface(), b.Message().Interface())
+	case protoreflect.BytesKind:
+		return bytes.Equal(a.Bytes(), b.Bytes())
+	default:
+		return a.Interface() == b.Interface()
+	}
+}
+
+// fieldMaskTree is a field mask as a tree of field names.  A node without
+// children selects the whole field.
+type fieldMaskTree map[protoreflect.Name]fieldMaskTree
+
+func newFieldMaskTree(paths []string) fieldMaskTree {
+	root := fieldMaskTree{}
+	for _, path := range paths {
+		node := root
+		parts := strings.Split(path, ".")
+		for i, part := range parts {
+			name := protoreflect.Name(part)
+			child, exists := node[name]
+			if exists && len(child) == 0 {
+				// Already selecting the whole field
+				break
+			}
+			if i == len(parts)-1 {
+				node[name] = fieldMaskTree{}
+				break
+			}
+			if !exists {
+				child = fieldMaskTree{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return root
+}
@@ -0,0 +1,101 @@
+package grpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func mask(paths ...string) *fieldmaskpb.FieldMask {
+	return &fieldmaskpb.FieldMask{Paths: paths}
+}
+
+func TestValidateFieldMask(t *testing.T) {
+	desc := (&testpb.SimpleRequest{}).ProtoReflect().Descriptor()
+	assert.Nil(t, ValidateFieldMask(mask("response_size", "payload.body"), desc))
+	assert.Nil(t, ValidateFieldMask(nil, desc))
+
+	err := ValidateFieldMask(mask("missing", "response_size.x", "payload.missing", ""), desc)
+	assert.NotNil(t, err)
+	assert.Equal(t, 4, len(FieldViolations(err)))
+}
+
+func TestApplyFieldMask(t *testing.T) {
+	dst := &testpb.SimpleRequest{
+		ResponseSize: 1,
+		FillUsername: true,
+		Payload:      &testpb.Payload{Type: testpb.PayloadType_COMPRESSABLE, Body: []byte("old")},
+	}
+	src := &testpb.SimpleRequest{
+		ResponseSize: 2,
+		Payload:      &testpb.Payload{Body: []byte("new")},
+	}
+	assert.Nil(t, ApplyFieldMask(mask("response_size", "fill_username", "payload.body"), src, dst))
+	assert.Equal(t, int32(2), dst.ResponseSize)
+	assert.False(t, dst.FillUsername)
+	assert.Equal(t, "new", string(dst.Payload.Body))
+	assert.Equal(t, testpb.PayloadType_COMPRESSABLE, dst.Payload.Type)
+
+	// dst does not share data with src
+	src.Payload.Body[0] = 'x'
+	assert.Equal(t, "new", string(dst.Payload.Body))
+
+	// Whole messages are replaced (and cleared)
+	assert.Nil(t, ApplyFieldMask(mask("payload"), &testpb.SimpleRequest{}, dst))
+	assert.Nil(t, dst.Payload)
+
+	assert.NotNil(t, ApplyFieldMask(mask("missing"), src, dst))
+	assert.NotNil(t, ApplyFieldMask(mask(), src, &testpb.Payload{}))
+
+	assert.Nil(t, ApplyFieldMask(mask(), src, dst))
+	assert.True(t, proto.Equal(src, dst))
+}
+
+func TestTrimToFieldMask(t *testing.T) {
+	msg := &testpb.SimpleRequest{
+		ResponseSize: 1,
+		FillUsername: true,
+		Payload:      &testpb.Payload{Type: testpb.PayloadType_COMPRESSABLE, Body: []byte("body")},
+	}
+	assert.Nil(t, TrimToFieldMask(mask("fill_username", "payload.body"), msg))
+	assert.True(t, proto.Equal(&testpb.SimpleRequest{
+		FillUsername: true,
+		Payload:      &testpb.Payload{Body: []byte("body")},
+	}, msg))
+}
+
+func TestDiffFieldMask(t *testing.T) {
+	a := &testpb.SimpleRequest{
+		ResponseSize: 1,
+		Payload:      &testpb.Payload{Type: testpb.PayloadType_COMPRESSABLE, Body: []byte("a")},
+	}
+	b := proto.Clone(a).(*testpb.SimpleRequest)
+	diff, err := DiffFieldMask(a, b)
+	assert.Nil(t, err)
+	assert.Empty(t, diff.Paths)
+
+	b.ResponseSize = 2
+	b.Payload.Body = []byte("b")
+	b.FillUsername = true
+	diff, err = DiffFieldMask(a, b)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"fill_username", "payload.body", "response_size"}, diff.Paths)
+
+	// Applying the diff makes the messages equal
+	assert.Nil(t, ApplyFieldMask(diff, b, a))
+	assert.True(t, proto.Equal(a, b))
+
+	// Maps are compared as a whole
+	sa, _ := structpb.NewStruct(map[string]any{"x": 1, "y": "two"})
+	sb, _ := structpb.NewStruct(map[string]any{"x": 1, "y": "three"})
+	diff, err = DiffFieldMask(sa, sb)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"fields"}, diff.Paths)
+
+	_, err = DiffFieldMask(a, sa)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,291 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Default limit on the size of request bodies accepted by a Gateway (same as
+// the default gRPC max receive message size).
+const DefaultGatewayMaxBodyBytes = 4 << 20
+
+// Gateway exposes the unary methods of gRPC services over HTTP without any
+// code generation.  Each method is served as POST /package.Service/Method
+// taking the JSON encoded request as the body and returning the JSON encoded
+// response.  Errors are returned as a JSON google.rpc.Status with the HTTP
+// status code matching the gRPC code (see HTTPStatusFromCode).
+//
+// Gateway implements grpc.ServiceRegistrar so services are registered with
+// the same generated Register...Server functions used for a grpc.Server.
+// Request headers selected by the IncomingHeaderMatcher are passed to
+// handlers as incoming metadata and headers set by handlers are returned as
+// response headers.
+type Gateway struct {
+	// Marshaller for requests and responses.  Defaults to DefaultMarshaller
+	Marshaller *Marshaller
+
+	// Interceptors to run around each handler (eg ErrorLogger or
+	// AuthInterceptor), outermost first
+	Interceptors []grpc.UnaryServerInterceptor
+
+	// Maximum request body size.  Defaults to DefaultGatewayMaxBodyBytes
+	MaxBodyBytes int64
+
+	// Decides which request headers are passed to handlers and the metadata
+	// key they are passed as.  Defaults to DefaultGatewayHeaderMatcher
+	IncomingHeaderMatcher func(key string) (string, bool)
+
+	mu      sync.RWMutex
+	methods map[string]gatewayMethod
+}
+
+type gatewayMethod struct {
+	impl any
+	desc grpc.MethodDesc
+}
+
+func NewGateway(interceptors ...grpc.UnaryServerInterceptor) *Gateway {
+	return &Gateway{Interceptors: interceptors}
+}
+
+// RegisterService registers the unary methods of a service.  Streaming
+// methods are ignored.  Panics if impl does not implement the service, like
+// grpc.Server does.
+func (g *Gateway) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	if impl != nil {
+		handlerType := reflect.TypeOf(desc.HandlerType).Elem()
+		if !reflect.TypeOf(impl).Implements(handlerType) {
+			panic(fmt.Sprintf("gateway: %T does not implement %v", impl, handlerType))
+		}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.methods == nil {
+		g.methods = make(map[string]gatewayMethod)
+	}
+	for _, method := range desc.Methods {
+		g.methods["/"+desc.ServiceName+"/"+method.MethodName] = gatewayMethod{impl: impl, desc: method}
+	}
+}
+
+// Methods returns the full names of all registered methods.
+func (g *Gateway) Methods() (out []string) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for name := range g.methods {
+		out = append(out, name)
+	}
+	return
+}
+
+func (g *Gateway) marshaller() *Marshaller {
+	if g.Marshaller == nil {
+		return DefaultMarshaller
+	}
+	return g.Marshaller
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.RLock()
+	method, ok := g.methods[r.URL.Path]
+	g.mu.RUnlock()
+	if !ok {
+		g.writeError(w, status.Errorf(codes.Unimplemented, "unknown method %s", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		g.writeStatus(w, http.StatusMethodNotAllowed, status.New(codes.Unimplemented, "only POST is supported"))
+		return
+	}
+
+	maxBytes := g.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultGatewayMaxBodyBytes
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			g.writeStatus(w, http.StatusRequestEntityTooLarge,
+				status.Newf(codes.ResourceExhausted, "request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		g.writeError(w, status.Errorf(codes.InvalidArgument, "failed to read request: %v", err))
+		return
+	}
+	if len(body) == 0 {
+		body = []byte("{}")
+	}
+
+	stream := &gatewayTransportStream{method: r.URL.Path}
+	ctx := grpc.NewContextWithServerTransportStream(r.Context(), stream)
+	ctx = metadata.NewIncomingContext(ctx, g.headersToMetadata(r.Header))
+	decode := func(req any) error {
+		if err := g.marshaller().Unmarshal(body, req.(proto.Message)); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid request: %v", err)
+		}
+		return nil
+	}
+	resp, err := method.desc.Handler(method.impl, ctx, decode, g.interceptor())
+
+	for key, values := range stream.header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	if err != nil {
+		g.writeError(w, ToStatusError(err))
+		return
+	}
+	// Generated handlers return a typed nil when the method returns (nil, nil)
+	msg, _ := resp.(proto.Message)
+	if msg == nil || !msg.ProtoReflect().IsValid() {
+		g.writeError(w, status.Errorf(codes.Internal, "method returned no response"))
+		return
+	}
+	data, err := g.marshaller().Marshal(msg)
+	if err != nil {
+		g.writeError(w, status.Errorf(codes.Internal, "failed to marshal response: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// interceptor chains the Interceptors into one or returns nil if there are
+// none (which the generated handlers treat as calling the method directly).
+func (g *Gateway) interceptor() grpc.UnaryServerInterceptor {
+	if len(g.Interceptors) == 0 {
+		return nil
+	}
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		chained := handler
+		for i := len(g.Interceptors) - 1; i >= 0; i-- {
+			interceptor, next := g.Interceptors[i], chained
+			chained = func(ctx context.Context, req any) (any, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return chained(ctx, req)
+	}
+}
+
+func (g *Gateway) writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	g.writeStatus(w, HTTPStatusFromCode(st.Code()), st)
+}
+
+func (g *Gateway) writeStatus(w http.ResponseWriter, httpStatus int, st *status.Status) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	data, err := g.marshaller().Marshal(st.Proto())
+	if err != nil {
+		// Eg details whose types cannot be resolved - send the bare status
+		data, _ = g.marshaller().Marshal(status.New(st.Code(), st.Message()).Proto())
+	}
+	w.Write(data)
+}
+
+// HTTPStatusFromCode returns the HTTP status code for a gRPC code, following
+// the mapping in google/rpc/code.proto.
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Prefix of request headers passed to handlers by DefaultGatewayHeaderMatcher
+const GatewayMetadataHeaderPrefix = "Grpc-Metadata-"
+
+// DefaultGatewayHeaderMatcher passes the "Authorization" header and headers
+// prefixed with "Grpc-Metadata-" (with the prefix removed, as in
+// grpc-gateway) to handlers.  All other headers are dropped so that
+// transport headers and arbitrary client headers do not turn into metadata
+// that interceptors trust (eg "x-request-id" or "idempotency-key").
+func DefaultGatewayHeaderMatcher(key string) (string, bool) {
+	key = http.CanonicalHeaderKey(key)
+	if key == "Authorization" {
+		return "authorization", true
+	}
+	if strings.HasPrefix(key, GatewayMetadataHeaderPrefix) && len(key) > len(GatewayMetadataHeaderPrefix) {
+		return key[len(GatewayMetadataHeaderPrefix):], true
+	}
+	return "", false
+}
+
+func (g *Gateway) headersToMetadata(header http.Header) metadata.MD {
+	matcher := g.IncomingHeaderMatcher
+	if matcher == nil {
+		matcher = DefaultGatewayHeaderMatcher
+	}
+	md := metadata.MD{}
+	for key, values := range header {
+		if mdKey, ok := matcher(key); ok {
+			md.Append(strings.ToLower(mdKey), values...)
+		}
+	}
+	return md
+}
+
+// gatewayTransportStream collects the headers handlers set with
+// grpc.SetHeader and grpc.SendHeader.  Trailers are dropped.
+type gatewayTransportStream struct {
+	method string
+	mu     sync.Mutex
+	header metadata.MD
+}
+
+func (s *gatewayTransportStream) Method() string {
+	return s.method
+}
+
+func (s *gatewayTransportStream) SetHeader(md metadata.MD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *gatewayTransportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *gatewayTransportStream) SetTrailer(md metadata.MD) error {
+	return nil
+}
@@ -0,0 +1,177 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func gatewayPost(t *testing.T, gw *Gateway, path string, body string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	gw.ServeHTTP(w, r)
+	return w
+}
+
+func TestGatewayUnaryCall(t *testing.T) {
+	svc := &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		grpc.SetHeader(ctx, metadata.Pairs("x-served-by", "gateway"))
+		return &testpb.SimpleResponse{Payload: req.Payload, Username: strings.Join(md.Get("x-user"), ",")}, nil
+	}}
+	gw := NewGateway()
+	testpb.RegisterTestServiceServer(gw, svc)
+	assert.Contains(t, gw.Methods(), "/grpc.testing.TestService/UnaryCall")
+	assert.NotContains(t, gw.Methods(), "/grpc.testing.TestService/StreamingOutputCall")
+
+	w := gatewayPost(t, gw, "/grpc.testing.TestService/UnaryCall", `{"payload": {"body": "aGk="}}`, "Grpc-Metadata-X-User", "alice")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "gateway", w.Header().Get("x-served-by"))
+
+	var resp testpb.SimpleResponse
+	assert.Nil(t, DefaultMarshaller.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "hi", string(resp.Payload.Body))
+	assert.Equal(t, "alice", resp.Username)
+
+	// Empty bodies are empty requests
+	w = gatewayPost(t, gw, "/grpc.testing.TestService/UnaryCall", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGatewayErrors(t *testing.T) {
+	svc := &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		if req.FillUsername {
+			return nil, os.ErrNotExist
+		}
+		return nil, status.Error(codes.PermissionDenied, "not yours")
+	}}
+	gw := NewGateway()
+	testpb.RegisterTestServiceServer(gw, svc)
+
+	w := gatewayPost(t, gw, "/grpc.testing.TestService/UnaryCall", `{}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var body map[string]any
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, float64(codes.PermissionDenied), body["code"])
+	assert.Equal(t, "not yours", body["message"])
+
+	w = gatewayPost(t, gw, "/grpc.testing.TestService/UnaryCall", `{"fill_username": true}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = gatewayPost(t, gw, "/grpc.testing.TestService/UnaryCall", `{"bad": `)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = gatewayPost(t, gw, "/grpc.testing.TestService/Missing", `{}`)
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+
+	r := httptest.NewRequest(http.MethodGet, "/grpc.testing.TestService/UnaryCall", nil)
+	w = httptest.NewRecorder()
+	gw.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestGatewayHeaderMatching(t *testing.T) {
+	var md metadata.MD
+	svc := &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		md, _ = metadata.FromIncomingContext(ctx)
+		return &testpb.SimpleResponse{}, nil
+	}}
+	gw := NewGateway()
+	testpb.RegisterTestServiceServer(gw, svc)
+
+	// Only the authorization and prefixed headers are passed on by default
+	w := gatewayPost(t, gw, "/grpc.testing.TestService/UnaryCall", `{}`,
+		"Authorization", "Bearer token", "Idempotency-Key", "k1", "Connection", "keep-alive",
+		"Grpc-Metadata-Idempotency-Key", "k2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"Bearer token"}, md.Get("authorization"))
+	assert.Equal(t, []string{"k2"}, md.Get(IdempotencyKeyHeader))
+	assert.Empty(t, md.Get("connection"))
+
+	gw.IncomingHeaderMatcher = func(key string) (string, bool) { return key, key == "X-Tenant" }
+	gatewayPost(t, gw, "/grpc.testing.TestService/UnaryCall", `{}`, "X-Tenant", "t1", "Authorization", "Bearer token")
+	assert.Equal(t, []string{"t1"}, md.Get("x-tenant"))
+	assert.Empty(t, md.Get("authorization"))
+
+	// Interceptors returning no response fail instead of panicking
+	gw.Interceptors = []grpc.UnaryServerInterceptor{
+		func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			return nil, nil
+		},
+	}
+	w = gatewayPost(t, gw, "/grpc.testing.TestService/UnaryCall", `{}`)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestGatewayNilResponse(t *testing.T) {
+	svc := &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		return nil, nil
+	}}
+	gw := NewGateway()
+	testpb.RegisterTestServiceServer(gw, svc)
+
+	// The typed nil from the generated handler is not a response
+	w := gatewayPost(t, gw, "/grpc.testing.TestService/UnaryCall", `{}`)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	var body map[string]any
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, float64(codes.Internal), body["code"])
+}
+
+func TestGatewayBodyLimit(t *testing.T) {
+	svc := &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		return &testpb.SimpleResponse{}, nil
+	}}
+	gw := NewGateway()
+	gw.MaxBodyBytes = 16
+	testpb.RegisterTestServiceServer(gw, svc)
+
+	w := gatewayPost(t, gw, "/grpc.testing.TestService/UnaryCall", `{"response_size": 1}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	var body map[string]any
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, float64(codes.ResourceExhausted), body["code"])
+
+	w = gatewayPost(t, gw, "/grpc.testing.TestService/UnaryCall", `{}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGatewayInterceptors(t *testing.T) {
+	var calls []string
+	record := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			calls = append(calls, name+":"+info.FullMethod)
+			return handler(ctx, req)
+		}
+	}
+	gw := NewGateway(record("outer"), record("inner"))
+	testpb.RegisterTestServiceServer(gw, &testService{})
+
+	w := gatewayPost(t, gw, "/grpc.testing.TestService/UnaryCall", `{}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"outer:/grpc.testing.TestService/UnaryCall", "inner:/grpc.testing.TestService/UnaryCall"}, calls)
+}
+
+func TestHTTPStatusFromCode(t *testing.T) {
+	assert.Equal(t, http.StatusOK, HTTPStatusFromCode(codes.OK))
+	assert.Equal(t, http.StatusBadRequest, HTTPStatusFromCode(codes.InvalidArgument))
+	assert.Equal(t, http.StatusUnauthorized, HTTPStatusFromCode(codes.Unauthenticated))
+	assert.Equal(t, http.StatusTooManyRequests, HTTPStatusFromCode(codes.ResourceExhausted))
+	assert.Equal(t, http.StatusGatewayTimeout, HTTPStatusFromCode(codes.DeadlineExceeded))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatusFromCode(codes.DataLoss))
+}
@@ -0,0 +1,221 @@
+// Package grpctest runs gRPC services in memory for tests.  A Server serves
+// the given services over a bufconn listener, hands out connected clients,
+// captures everything logged by its interceptors and is shut down when the
+// test ends:
+//
+//	srv := grpctest.New(t,
+//		grpctest.WithService(&pb.MyService_ServiceDesc, impl),
+//		grpctest.WithErrorLogger())
+//	client := pb.NewMyServiceClient(srv.Conn)
+//	...
+//	assert.Contains(t, srv.Logs(), "[PANIC]")
+package grpctest
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+
+	gut "github.com/panyam/goutils/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const bufSize = 1 << 20
+
+// Server is an in-memory gRPC server along with a client connected to it.
+type Server struct {
+	// The underlying server
+	Server *grpc.Server
+
+	// Client connection to the server
+	Conn *grpc.ClientConn
+
+	// Logger writing into the captured logs.  Used by the ErrorLogger
+	// installed by WithErrorLogger and can be passed to other interceptors.
+	Logger *slog.Logger
+
+	t        testing.TB
+	listener *bufconn.Listener
+	logs     *logBuffer
+}
+
+// Option customizes a Server.
+type Option func(c *config)
+
+type service struct {
+	desc *grpc.ServiceDesc
+	impl any
+}
+
+type config struct {
+	services           []service
+	unaryInterceptors  []grpc.UnaryServerInterceptor
+	streamInterceptors []grpc.StreamServerInterceptor
+	errorLoggerOpts    []gut.ErrorLoggerOption
+	errorLogger        bool
+	serverOpts         []grpc.ServerOption
+	dialOpts           []grpc.DialOption
+	captureStdLog      bool
+	logLevel           slog.Level
+}
+
+// WithService registers a service implementation, eg
+// WithService(&pb.MyService_ServiceDesc, impl).
+func WithService(desc *grpc.ServiceDesc, impl any) Option {
+	return func(c *config) {
+		c.services = append(c.services, service{desc: desc, impl: impl})
+	}
+}
+
+// WithUnaryInterceptors adds server interceptors, run in the order given
+// (after the ErrorLogger if there is one).
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(c *config) {
+		c.unaryInterceptors = append(c.unaryInterceptors, interceptors...)
+	}
+}
+
+// WithStreamInterceptors is the streaming counterpart of WithUnaryInterceptors.
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) Option {
+	return func(c *config) {
+		c.streamInterceptors = append(c.streamInterceptors, interceptors...)
+	}
+}
+
+// WithErrorLogger installs ErrorLogger and StreamErrorLogger as the outermost
+// interceptors, logging into the captured logs.  Options are passed on
+// (a WithLogger option overrides the capturing logger).
+func WithErrorLogger(opts ...gut.ErrorLoggerOption) Option {
+	return func(c *config) {
+		c.errorLogger = true
+		c.errorLoggerOpts = append(c.errorLoggerOpts, opts...)
+	}
+}
+
+// WithServerOptions passes extra options to grpc.NewServer.
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(c *config) {
+		c.serverOpts = append(c.serverOpts, opts...)
+	}
+}
+
+// WithDialOptions passes extra options (eg client interceptors) when dialing
+// Conn.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(c *config) {
+		c.dialOpts = append(c.dialOpts, opts...)
+	}
+}
+
+// WithLogLevel sets the minimum level captured by Logger.  Defaults to
+// slog.LevelDebug.
+func WithLogLevel(level slog.Level) Option {
+	return func(c *config) {
+		c.logLevel = level
+	}
+}
+
+// WithStdLog also captures output of the standard logger (and so of
+// slog.Default) for the duration of the test.  As this changes global state
+// it should not be used in parallel tests.
+func WithStdLog() Option {
+	return func(c *config) {
+		c.captureStdLog = true
+	}
+}
+
+// New starts a server with the given options and connects a client to it.
+// Both are shut down when the test ends.
+func New(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+	c := &config{logLevel: slog.LevelDebug}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	s := &Server{t: t, listener: bufconn.Listen(bufSize), logs: &logBuffer{}}
+	s.Logger = slog.New(slog.NewTextHandler(s.logs, &slog.HandlerOptions{Level: c.logLevel}))
+	if c.captureStdLog {
+		prev := log.Writer()
+		log.SetOutput(s.logs)
+		t.Cleanup(func() { log.SetOutput(prev) })
+	}
+
+	unary, stream := c.unaryInterceptors, c.streamInterceptors
+	if c.errorLogger {
+		errorLoggerOpts := append([]gut.ErrorLoggerOption{gut.WithLogger(s.Logger)}, c.errorLoggerOpts...)
+		unary = append([]grpc.UnaryServerInterceptor{gut.ErrorLogger(errorLoggerOpts...)}, unary...)
+		stream = append([]grpc.StreamServerInterceptor{gut.StreamErrorLogger(errorLoggerOpts...)}, stream...)
+	}
+	serverOpts := append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}, c.serverOpts...)
+
+	s.Server = grpc.NewServer(serverOpts...)
+	for _, svc := range c.services {
+		s.Server.RegisterService(svc.desc, svc.impl)
+	}
+	go s.Server.Serve(s.listener)
+	t.Cleanup(s.Server.Stop)
+
+	s.Conn = s.Dial(c.dialOpts...)
+	return s
+}
+
+// Dial opens another client connection to the server, eg with different
+// client interceptors.  It is closed when the test ends.
+func (s *Server) Dial(opts ...grpc.DialOption) *grpc.ClientConn {
+	s.t.Helper()
+	opts = append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return s.listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+	conn, err := grpc.DialContext(context.Background(), "bufnet", opts...)
+	if err != nil {
+		s.t.Fatalf("grpctest: dial failed: %v", err)
+	}
+	s.t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// Logs returns everything logged so far.
+func (s *Server) Logs() string {
+	return s.logs.String()
+}
+
+// ResetLogs discards the logs captured so far.
+func (s *Server) ResetLogs() {
+	s.logs.Reset()
+}
+
+// logBuffer is a bytes.Buffer that is safe to write to from handlers while
+// the test reads it.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *logBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
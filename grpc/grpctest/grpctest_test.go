@@ -0,0 +1,78 @@
+package grpctest
+
+import (
+	"context"
+	"log"
+	"testing"
+
+	gut "github.com/panyam/goutils/grpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type testService struct {
+	testpb.UnimplementedTestServiceServer
+}
+
+func (s *testService) UnaryCall(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	switch req.ResponseSize {
+	case 1:
+		panic("boom")
+	case 2:
+		return nil, status.Error(codes.Internal, "broken")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return &testpb.SimpleResponse{Payload: req.Payload, Username: md["x-user"][0]}, nil
+}
+
+func TestServerWithErrorLogger(t *testing.T) {
+	var seen []string
+	srv := New(t,
+		WithService(&testpb.TestService_ServiceDesc, &testService{}),
+		WithErrorLogger(gut.WithStackTrace(false)),
+		WithUnaryInterceptors(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			seen = append(seen, info.FullMethod)
+			return handler(ctx, req)
+		}),
+		WithDialOptions(grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(metadata.AppendToOutgoingContext(ctx, "x-user", "alice"), method, req, reply, cc, opts...)
+		})))
+	client := testpb.NewTestServiceClient(srv.Conn)
+
+	resp, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", resp.Username)
+	assert.Equal(t, []string{"/grpc.testing.TestService/UnaryCall"}, seen)
+	assert.Equal(t, "", srv.Logs())
+
+	_, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{ResponseSize: 1})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, srv.Logs(), "[PANIC] boom")
+
+	srv.ResetLogs()
+	_, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{ResponseSize: 2})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, srv.Logs(), "broken")
+	assert.NotContains(t, srv.Logs(), "[PANIC]")
+}
+
+func TestServerDial(t *testing.T) {
+	srv := New(t, WithService(&testpb.TestService_ServiceDesc, &testService{}))
+	conn := srv.Dial()
+	assert.True(t, srv.Conn != conn)
+
+	_, err := testpb.NewTestServiceClient(conn).EmptyCall(context.Background(), &testpb.Empty{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestServerCapturesStdLog(t *testing.T) {
+	srv := New(t, WithStdLog())
+	log.Print("hello from the standard logger")
+	srv.Logger.Info("hello from slog")
+	assert.Contains(t, srv.Logs(), "hello from the standard logger")
+	assert.Contains(t, srv.Logs(), "hello from slog")
+}
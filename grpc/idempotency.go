@@ -0,0 +1,366 @@
+package grpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/panyam/goutils/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Incoming metadata key carrying the client chosen idempotency key
+const IdempotencyKeyHeader = "idempotency-key"
+
+// Response header set to "true" when a stored response is replayed
+const IdempotentReplayHeader = "idempotent-replayed"
+
+// IdempotencyStore holds serialized responses by key until they expire.
+type IdempotencyStore interface {
+	// Get returns the value stored for key if it has not expired
+	Get(ctx context.Context, key string) (value []byte, found bool, err error)
+
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// IdempotencyConfig controls which calls IdempotencyInterceptor deduplicates.
+type IdempotencyConfig struct {
+	Store IdempotencyStore
+
+	// How long responses are kept.  Defaults to 24 hours
+	TTL time.Duration
+
+	// Full method names to deduplicate (eg the mutating ones).  Empty means
+	// all methods called with an idempotency key.
+	Methods []string
+
+	// Scope (eg the caller's subject) so that keys chosen by different
+	// callers never collide.  Defaults to the subject of the Principal
+	// injected by AuthInterceptor (so install this after it).  Without a
+	// scope keys are shared by all callers and anyone who guesses another
+	// caller's key is sent that caller's response.
+	Scope func(ctx context.Context) string
+}
+
+// IdempotencyInterceptor deduplicates calls carrying the same idempotency key
+// (in the "idempotency-key" metadata).  The first successful response is
+// stored and replayed to later calls with the same key (and method and
+// scope) until it expires, without calling the handler again.  Duplicates
+// arriving while the first call is still running wait for its result.
+// Errors are neither stored nor shared so failed calls can be retried with
+// the same key - if the first call fails (eg because its own client went
+// away) one of the waiting duplicates runs the handler in its place.
+// Duplicates waiting on a call whose handler panics fail with Internal.
+//
+// A hash of the request is stored with the response and reusing a key with
+// a different request fails with FailedPrecondition rather than replaying
+// the response of the original request.
+func IdempotencyInterceptor(config IdempotencyConfig) grpc.UnaryServerInterceptor {
+	if config.TTL <= 0 {
+		config.TTL = 24 * time.Hour
+	}
+	var mu sync.Mutex
+	inFlight := make(map[string]*idempotentCall)
+
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		key := idempotencyKey(ctx)
+		if key == "" || (len(config.Methods) > 0 && !slices.Contains(config.Methods, info.FullMethod)) {
+			return handler(ctx, req)
+		}
+		storeKey := info.FullMethod + "\x00" + config.scope(ctx) + "\x00" + key
+		fingerprint := requestFingerprint(req)
+
+		// Wait for any call in flight with the same key.  If it ends without
+		// a result to share this call takes over.
+		var call *idempotentCall
+		for call == nil {
+			mu.Lock()
+			existing, waiting := inFlight[storeKey]
+			if !waiting {
+				call = &idempotentCall{done: make(chan struct{}), fingerprint: fingerprint}
+				inFlight[storeKey] = call
+			}
+			mu.Unlock()
+			if waiting {
+				if resp, done, err := existing.wait(ctx, key, fingerprint); done {
+					return resp, err
+				}
+			}
+		}
+		defer func() {
+			// Waiters must not see an empty result if the handler panics
+			p := recover()
+			if p != nil {
+				call.err = status.Error(codes.Internal, "idempotent call failed")
+			}
+			mu.Lock()
+			delete(inFlight, storeKey)
+			mu.Unlock()
+			close(call.done)
+			if p != nil {
+				panic(p)
+			}
+		}()
+
+		if resp, storedFingerprint, ok := config.load(ctx, storeKey); ok {
+			if storedFingerprint != fingerprint {
+				call.err = errIdempotencyKeyReused(key)
+				return nil, call.err
+			}
+			call.resp = resp
+			grpc.SetHeader(ctx, metadata.Pairs(IdempotentReplayHeader, "true"))
+			return proto.Clone(resp), nil
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			// Not shared with waiters as the error may be specific to this
+			// call (eg its deadline passing)
+			return nil, err
+		}
+		msg, ok := resp.(proto.Message)
+		if !ok {
+			return resp, nil
+		}
+		call.resp = proto.Clone(msg)
+		config.save(ctx, storeKey, fingerprint, msg)
+		return resp, nil
+	}
+}
+
+type idempotentCall struct {
+	done        chan struct{}
+	fingerprint [sha256.Size]byte
+	resp        proto.Message
+	err         error
+}
+
+// wait waits for the call to finish and returns its result.  done is false
+// if the call ended without a result to share (eg it failed or its response
+// was not a message) and the caller should run the call itself.
+func (c *idempotentCall) wait(ctx context.Context, key string, fingerprint [sha256.Size]byte) (resp interface{}, done bool, err error) {
+	if c.fingerprint != fingerprint {
+		return nil, true, errIdempotencyKeyReused(key)
+	}
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return nil, true, ToStatusError(ctx.Err())
+	}
+	if c.err != nil {
+		return nil, true, c.err
+	}
+	if c.resp == nil {
+		return nil, false, nil
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(IdempotentReplayHeader, "true"))
+	return proto.Clone(c.resp), true, nil
+}
+
+func errIdempotencyKeyReused(key string) error {
+	return status.Errorf(codes.FailedPrecondition, "idempotency key %q was already used with a different request", key)
+}
+
+func idempotencyKey(ctx context.Context) string {
+	if values := metadata.ValueFromIncomingContext(ctx, IdempotencyKeyHeader); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c *IdempotencyConfig) scope(ctx context.Context) string {
+	if c.Scope != nil {
+		return c.Scope(ctx)
+	}
+	if principal, ok := PrincipalFromContext(ctx); ok && principal != nil {
+		return principal.Subject
+	}
+	return ""
+}
+
+// requestFingerprint hashes the deterministic encoding of a request.
+func requestFingerprint(req interface{}) (out [sha256.Size]byte) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return
+	}
+	return sha256.Sum256(data)
+}
+
+// load returns the stored response for a key along with the fingerprint of
+// the request it was for.  Store failures are logged and treated as a miss
+// so the call still goes through.
+func (c *IdempotencyConfig) load(ctx context.Context, key string) (resp proto.Message, fingerprint [sha256.Size]byte, ok bool) {
+	data, found, err := c.Store.Get(ctx, key)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to load idempotent response", "error", err)
+		return
+	}
+	if !found {
+		return
+	}
+	// Stored values are the request fingerprint followed by the response as
+	// an Any so it can be decoded without knowing the method's response type
+	if len(data) < sha256.Size {
+		slog.WarnContext(ctx, "failed to decode idempotent response", "error", "value too short")
+		return
+	}
+	copy(fingerprint[:], data)
+	var stored anypb.Any
+	if err := proto.Unmarshal(data[sha256.Size:], &stored); err != nil {
+		slog.WarnContext(ctx, "failed to decode idempotent response", "error", err)
+		return
+	}
+	if resp, err = stored.UnmarshalNew(); err != nil {
+		slog.WarnContext(ctx, "failed to decode idempotent response", "error", err)
+		return
+	}
+	return resp, fingerprint, true
+}
+
+func (c *IdempotencyConfig) save(ctx context.Context, key string, fingerprint [sha256.Size]byte, resp proto.Message) {
+	stored, err := anypb.New(resp)
+	if err == nil {
+		var data []byte
+		if data, err = proto.Marshal(stored); err == nil {
+			err = c.Store.Put(ctx, key, append(fingerprint[:], data...), c.TTL)
+		}
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "failed to store idempotent response", "error", err)
+	}
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore for a single process.
+// Expired entries are removed as new ones are added.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryIdempotencyEntry
+}
+
+type memoryIdempotencyEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: make(map[string]memoryIdempotencyEntry)}
+}
+
+func (s *MemoryIdempotencyStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (s *MemoryIdempotencyStore) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = memoryIdempotencyEntry{value: value, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// FileIdempotencyStore is an IdempotencyStore backed by a FileStorage so
+// stored responses survive restarts.  Each key is kept as an entity (named
+// by the hash of the key) with a single artifact.
+type FileIdempotencyStore struct {
+	Storage *storage.FileStorage
+
+	// Name of the artifact holding the response.  Defaults to "idempotency"
+	Artifact string
+}
+
+func NewFileIdempotencyStore(fs *storage.FileStorage) *FileIdempotencyStore {
+	return &FileIdempotencyStore{Storage: fs, Artifact: "idempotency"}
+}
+
+func (s *FileIdempotencyStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	id := fileIdempotencyId(key)
+	var entry structpb.Struct
+	if err := s.Storage.LoadArtifact(id, s.artifact(), &entry); err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	expiresAt, err := time.Parse(time.RFC3339Nano, entry.Fields["expires_at"].GetStringValue())
+	if err != nil || time.Now().After(expiresAt) {
+		return nil, false, s.Storage.DeleteEntity(id)
+	}
+	value, err := base64.StdEncoding.DecodeString(entry.Fields["value"].GetStringValue())
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (s *FileIdempotencyStore) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"value":      structpb.NewStringValue(base64.StdEncoding.EncodeToString(value)),
+		"expires_at": structpb.NewStringValue(time.Now().Add(ttl).UTC().Format(time.RFC3339Nano)),
+	}}
+	return s.Storage.AtomicSaveArtifact(fileIdempotencyId(key), s.artifact(), entry)
+}
+
+// PurgeExpired deletes all expired entries, eg from a periodic job.
+func (s *FileIdempotencyStore) PurgeExpired() error {
+	ids, err := s.Storage.ListEntityIds()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, id := range ids {
+		var entry structpb.Struct
+		if err := s.Storage.LoadArtifact(id, s.artifact(), &entry); err != nil {
+			continue
+		}
+		expiresAt, err := time.Parse(time.RFC3339Nano, entry.Fields["expires_at"].GetStringValue())
+		if err != nil || now.After(expiresAt) {
+			if err := s.Storage.DeleteEntity(id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *FileIdempotencyStore) artifact() string {
+	if s.Artifact == "" {
+		return "idempotency"
+	}
+	return s.Artifact
+}
+
+func fileIdempotencyId(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,271 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/panyam/goutils/storage"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// countingService returns the number of times it was called as the username
+func countingService(calls *atomic.Int32, release chan struct{}) *testService {
+	return &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		n := calls.Add(1)
+		if release != nil {
+			<-release
+		}
+		if req.FillUsername {
+			return nil, status.Error(codes.Unavailable, "try again")
+		}
+		return &testpb.SimpleResponse{Username: string(rune('0' + n))}, nil
+	}}
+}
+
+func withIdempotencyKey(key string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), IdempotencyKeyHeader, key)
+}
+
+func TestIdempotencyInterceptorReplays(t *testing.T) {
+	var calls atomic.Int32
+	interceptor := IdempotencyInterceptor(IdempotencyConfig{Store: NewMemoryIdempotencyStore()})
+	conn := startTestServer(t, countingService(&calls, nil), []grpc.ServerOption{grpc.UnaryInterceptor(interceptor)})
+	client := testpb.NewTestServiceClient(conn)
+
+	resp, err := client.UnaryCall(withIdempotencyKey("a"), &testpb.SimpleRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, "1", resp.Username)
+
+	var header metadata.MD
+	resp, err = client.UnaryCall(withIdempotencyKey("a"), &testpb.SimpleRequest{}, grpc.Header(&header))
+	assert.Nil(t, err)
+	assert.Equal(t, "1", resp.Username)
+	assert.Equal(t, []string{"true"}, header.Get(IdempotentReplayHeader))
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Other keys and calls without keys go through
+	resp, _ = client.UnaryCall(withIdempotencyKey("b"), &testpb.SimpleRequest{})
+	assert.Equal(t, "2", resp.Username)
+	resp, _ = client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Equal(t, "3", resp.Username)
+
+	// Errors are not stored
+	_, err = client.UnaryCall(withIdempotencyKey("c"), &testpb.SimpleRequest{FillUsername: true})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	resp, err = client.UnaryCall(withIdempotencyKey("c"), &testpb.SimpleRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, "5", resp.Username)
+}
+
+func TestIdempotencyInterceptorConcurrentDuplicates(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	interceptor := IdempotencyInterceptor(IdempotencyConfig{Store: NewMemoryIdempotencyStore()})
+	conn := startTestServer(t, countingService(&calls, release), []grpc.ServerOption{grpc.UnaryInterceptor(interceptor)})
+	client := testpb.NewTestServiceClient(conn)
+
+	var wg sync.WaitGroup
+	results := make([]string, 5)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.UnaryCall(withIdempotencyKey("same"), &testpb.SimpleRequest{})
+			if assert.Nil(t, err) {
+				results[i] = resp.Username
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, []string{"1", "1", "1", "1", "1"}, results)
+}
+
+func TestIdempotencyInterceptorMethods(t *testing.T) {
+	var calls atomic.Int32
+	interceptor := IdempotencyInterceptor(IdempotencyConfig{
+		Store:   NewMemoryIdempotencyStore(),
+		Methods: []string{"/grpc.testing.TestService/Other"},
+	})
+	conn := startTestServer(t, countingService(&calls, nil), []grpc.ServerOption{grpc.UnaryInterceptor(interceptor)})
+	client := testpb.NewTestServiceClient(conn)
+	client.UnaryCall(withIdempotencyKey("a"), &testpb.SimpleRequest{})
+	client.UnaryCall(withIdempotencyKey("a"), &testpb.SimpleRequest{})
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestMemoryIdempotencyStoreExpiry(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	ctx := context.Background()
+	assert.Nil(t, store.Put(ctx, "k", []byte("v"), 20*time.Millisecond))
+	value, found, _ := store.Get(ctx, "k")
+	assert.True(t, found)
+	assert.Equal(t, "v", string(value))
+	time.Sleep(30 * time.Millisecond)
+	_, found, _ = store.Get(ctx, "k")
+	assert.False(t, found)
+}
+
+func TestFileIdempotencyStore(t *testing.T) {
+	fs := storage.NewFileStorage(t.TempDir())
+	store := NewFileIdempotencyStore(fs)
+	ctx := context.Background()
+
+	_, found, err := store.Get(ctx, "missing")
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	assert.Nil(t, store.Put(ctx, "k", []byte{0, 1, 2}, time.Hour))
+	value, found, err := store.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte{0, 1, 2}, value)
+
+	assert.Nil(t, store.Put(ctx, "short", []byte("x"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	assert.Nil(t, store.PurgeExpired())
+	ids, _ := fs.ListEntityIds()
+	assert.Equal(t, 1, len(ids))
+	_, found, _ = store.Get(ctx, "short")
+	assert.False(t, found)
+
+	// Responses survive a restart of the interceptor
+	var calls atomic.Int32
+	svc := countingService(&calls, nil)
+	for range 2 {
+		interceptor := IdempotencyInterceptor(IdempotencyConfig{Store: NewFileIdempotencyStore(fs)})
+		conn := startTestServer(t, svc, []grpc.ServerOption{grpc.UnaryInterceptor(interceptor)})
+		resp, err := testpb.NewTestServiceClient(conn).UnaryCall(withIdempotencyKey("persisted"), &testpb.SimpleRequest{})
+		assert.Nil(t, err)
+		assert.Equal(t, "1", resp.Username)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestIdempotencyInterceptorPanicWithWaiters(t *testing.T) {
+	interceptor := IdempotencyInterceptor(IdempotencyConfig{Store: NewMemoryIdempotencyStore()})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(IdempotencyKeyHeader, "k"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}
+	started, release := make(chan struct{}), make(chan struct{})
+
+	leaderPanicked := make(chan any, 1)
+	go func() {
+		defer func() { leaderPanicked <- recover() }()
+		interceptor(ctx, &testpb.SimpleRequest{}, info, func(ctx context.Context, req any) (any, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := interceptor(ctx, &testpb.SimpleRequest{}, info, func(ctx context.Context, req any) (any, error) {
+				return &testpb.SimpleResponse{}, nil
+			})
+			assert.Nil(t, resp)
+			errs[i] = err
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, "boom", <-leaderPanicked)
+	for _, err := range errs {
+		assert.Equal(t, codes.Internal, status.Code(err))
+	}
+}
+
+func TestIdempotencyInterceptorWaitersTakeOverFailedCalls(t *testing.T) {
+	interceptor := IdempotencyInterceptor(IdempotencyConfig{Store: NewMemoryIdempotencyStore()})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(IdempotencyKeyHeader, "k"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}
+	started, release := make(chan struct{}), make(chan struct{})
+
+	// The first call fails with an error specific to it
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := interceptor(ctx, &testpb.SimpleRequest{}, info, func(ctx context.Context, req any) (any, error) {
+			close(started)
+			<-release
+			return nil, status.Error(codes.Canceled, "client went away")
+		})
+		leaderErr <- err
+	}()
+	<-started
+
+	var calls atomic.Int32
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := interceptor(ctx, &testpb.SimpleRequest{}, info, func(ctx context.Context, req any) (any, error) {
+				calls.Add(1)
+				return &testpb.SimpleResponse{Username: "retried"}, nil
+			})
+			if assert.NotNil(t, resp) {
+				assert.Equal(t, "retried", resp.(*testpb.SimpleResponse).Username)
+			}
+			errs[i] = err
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// One waiter runs the call and the others share its response
+	assert.Equal(t, codes.Canceled, status.Code(<-leaderErr))
+	assert.Equal(t, int32(1), calls.Load())
+	for _, err := range errs {
+		assert.Nil(t, err)
+	}
+}
+
+func TestIdempotencyInterceptorRejectsReusedKeys(t *testing.T) {
+	var calls atomic.Int32
+	interceptor := IdempotencyInterceptor(IdempotencyConfig{Store: NewMemoryIdempotencyStore()})
+	conn := startTestServer(t, countingService(&calls, nil), []grpc.ServerOption{grpc.UnaryInterceptor(interceptor)})
+	client := testpb.NewTestServiceClient(conn)
+
+	_, err := client.UnaryCall(withIdempotencyKey("a"), &testpb.SimpleRequest{ResponseSize: 1})
+	assert.Nil(t, err)
+	_, err = client.UnaryCall(withIdempotencyKey("a"), &testpb.SimpleRequest{ResponseSize: 2})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.UnaryCall(withIdempotencyKey("a"), &testpb.SimpleRequest{ResponseSize: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestIdempotencyInterceptorScopesByPrincipal(t *testing.T) {
+	interceptor := IdempotencyInterceptor(IdempotencyConfig{Store: NewMemoryIdempotencyStore()})
+	info := &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}
+	calls := 0
+	handler := func(ctx context.Context, req any) (any, error) {
+		calls++
+		return &testpb.SimpleResponse{}, nil
+	}
+	for _, subject := range []string{"alice", "bob", "alice"} {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(IdempotencyKeyHeader, "k"))
+		ctx = ContextWithPrincipal(ctx, &Principal{Subject: subject})
+		_, err := interceptor(ctx, &testpb.SimpleRequest{}, info, handler)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,228 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/panyam/goutils/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// HealthChecker reports whether a dependency of a service is healthy.
+type HealthChecker interface {
+	Check(ctx context.Context) error
+}
+
+// HealthCheckerFunc adapts a function to the HealthChecker interface.
+type HealthCheckerFunc func(ctx context.Context) error
+
+func (f HealthCheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// DirWritableChecker checks that files can be created in a directory.
+func DirWritableChecker(dir string) HealthChecker {
+	return HealthCheckerFunc(func(ctx context.Context) error {
+		f, err := os.CreateTemp(dir, ".healthcheck-*")
+		if err != nil {
+			return fmt.Errorf("%s is not writable: %w", dir, err)
+		}
+		f.Close()
+		return os.Remove(f.Name())
+	})
+}
+
+// StorageWritableChecker checks that a FileStorage's directory is writable.
+func StorageWritableChecker(fs *storage.FileStorage) HealthChecker {
+	return DirWritableChecker(fs.StorageDir())
+}
+
+// Lifecycle runs a grpc.Server along with the standard health service.  The
+// health of each service is kept up to date by periodically running its
+// checkers, and on SIGTERM (or SIGINT) the server reports NOT_SERVING and
+// drains in-flight RPCs before stopping.
+type Lifecycle struct {
+	Server *grpc.Server
+	Health *health.Server
+
+	// How often checkers are run.  Defaults to 10s
+	CheckInterval time.Duration
+
+	// Timeout for each round of checks.  Defaults to 5s
+	CheckTimeout time.Duration
+
+	// How long to keep serving after reporting NOT_SERVING on shutdown so
+	// load balancers and probes notice before the listener closes.  Zero
+	// (the default) starts draining straight away
+	PreDrainDelay time.Duration
+
+	// How long in-flight RPCs are given to finish on shutdown before the
+	// server is stopped forcibly.  Defaults to 30s
+	DrainTimeout time.Duration
+
+	// Logger check failures and shutdown progress are written to.  Defaults
+	// to slog.Default()
+	Logger *slog.Logger
+
+	mu       sync.Mutex
+	checkers map[string][]HealthChecker
+	stopping bool
+}
+
+// NewLifecycle registers the health service on server.  Register all other
+// services before calling Serve so they are reported as SERVING.
+func NewLifecycle(server *grpc.Server) *Lifecycle {
+	l := &Lifecycle{Server: server, Health: health.NewServer(), checkers: make(map[string][]HealthChecker)}
+	healthpb.RegisterHealthServer(server, l.Health)
+	return l
+}
+
+// AddChecker ties a service's health to a checker.  Checkers added for the
+// empty service name apply to every service (and the server as a whole).
+func (l *Lifecycle) AddChecker(service string, checker HealthChecker) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.checkers[service] = append(l.checkers[service], checker)
+}
+
+// CheckNow runs all checkers and updates the serving status of every
+// service.  A service is SERVING only if its own checkers and the server wide
+// ones pass, while the server as a whole (the "" service) only depends on
+// the server wide checkers.  Does nothing once shutdown has started.
+func (l *Lifecycle) CheckNow(ctx context.Context) {
+	// Checkers run without the lock so slow ones do not hold up Shutdown
+	l.mu.Lock()
+	if l.stopping {
+		l.mu.Unlock()
+		return
+	}
+	checkers := make(map[string][]HealthChecker, len(l.checkers))
+	for service, serviceCheckers := range l.checkers {
+		checkers[service] = append([]HealthChecker(nil), serviceCheckers...)
+	}
+	l.mu.Unlock()
+
+	timeout := l.CheckTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	failed := make(map[string]bool)
+	for service, serviceCheckers := range checkers {
+		for _, checker := range serviceCheckers {
+			if err := checker.Check(ctx); err != nil {
+				l.logger().WarnContext(ctx, "health check failed", "service", service, "error", err)
+				failed[service] = true
+				break
+			}
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopping {
+		return
+	}
+	l.Health.SetServingStatus("", servingStatus(!failed[""]))
+	for service := range l.Server.GetServiceInfo() {
+		if service == healthpb.Health_ServiceDesc.ServiceName {
+			continue
+		}
+		l.Health.SetServingStatus(service, servingStatus(!failed[""] && !failed[service]))
+	}
+}
+
+func servingStatus(healthy bool) healthpb.HealthCheckResponse_ServingStatus {
+	if healthy {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
+
+// Serve serves on lis until SIGTERM or SIGINT is received and then shuts
+// down gracefully.
+func (l *Lifecycle) Serve(lis net.Listener) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	return l.ServeContext(ctx, lis)
+}
+
+// ServeContext serves on lis until ctx is done and then shuts down
+// gracefully.  Returns the error from grpc.Server.Serve, if any.
+func (l *Lifecycle) ServeContext(ctx context.Context, lis net.Listener) error {
+	l.CheckNow(ctx)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- l.Server.Serve(lis) }()
+
+	ticker := time.NewTicker(l.checkInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-serveErr:
+			return err
+		case <-ticker.C:
+			l.CheckNow(ctx)
+		case <-ctx.Done():
+			l.Shutdown()
+			return <-serveErr
+		}
+	}
+}
+
+// Shutdown marks all services NOT_SERVING, waits for PreDrainDelay and then
+// gracefully stops the server, forcibly stopping it if in-flight RPCs take
+// longer than DrainTimeout.
+func (l *Lifecycle) Shutdown() {
+	l.mu.Lock()
+	l.stopping = true
+	l.Health.Shutdown()
+	l.mu.Unlock()
+
+	if l.PreDrainDelay > 0 {
+		l.logger().Info("reported NOT_SERVING, waiting before draining", "delay", l.PreDrainDelay)
+		time.Sleep(l.PreDrainDelay)
+	}
+
+	timeout := l.DrainTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	l.logger().Info("shutting down, draining in-flight requests", "timeout", timeout)
+	stopped := make(chan struct{})
+	go func() {
+		l.Server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		l.logger().Warn("drain timed out, stopping server")
+		l.Server.Stop()
+		<-stopped
+	}
+}
+
+func (l *Lifecycle) checkInterval() time.Duration {
+	if l.CheckInterval <= 0 {
+		return 10 * time.Second
+	}
+	return l.CheckInterval
+}
+
+func (l *Lifecycle) logger() *slog.Logger {
+	if l.Logger == nil {
+		return slog.Default()
+	}
+	return l.Logger
+}
@@ -0,0 +1,164 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/panyam/goutils/storage"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startLifecycle serves svc with a Lifecycle until the returned cancel func
+// is called.  The returned channel receives the result of ServeContext.
+func startLifecycle(t *testing.T, svc testpb.TestServiceServer, setup func(l *Lifecycle)) (*grpc.ClientConn, context.CancelFunc, chan error) {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	testpb.RegisterTestServiceServer(server, svc)
+	l := NewLifecycle(server)
+	l.CheckInterval = 10 * time.Millisecond
+	l.Logger = slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	setup(l)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- l.ServeContext(ctx, lis) }()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		cancel()
+		conn.Close()
+	})
+	return conn, cancel, done
+}
+
+func healthStatus(t *testing.T, conn *grpc.ClientConn, service string) healthpb.HealthCheckResponse_ServingStatus {
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	assert.Nil(t, err)
+	return resp.GetStatus()
+}
+
+func TestLifecycleHealthCheckers(t *testing.T) {
+	var failing atomic.Bool
+	conn, _, _ := startLifecycle(t, &testService{}, func(l *Lifecycle) {
+		l.AddChecker("grpc.testing.TestService", HealthCheckerFunc(func(ctx context.Context) error {
+			if failing.Load() {
+				return errors.New("dependency down")
+			}
+			return nil
+		}))
+	})
+
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, healthStatus(t, conn, ""))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, healthStatus(t, conn, "grpc.testing.TestService"))
+
+	failing.Store(true)
+	assert.Eventually(t, func() bool {
+		return healthStatus(t, conn, "grpc.testing.TestService") == healthpb.HealthCheckResponse_NOT_SERVING
+	}, time.Second, 5*time.Millisecond)
+	// A single service failing does not take the whole server out
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, healthStatus(t, conn, ""))
+
+	failing.Store(false)
+	assert.Eventually(t, func() bool {
+		return healthStatus(t, conn, "grpc.testing.TestService") == healthpb.HealthCheckResponse_SERVING
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestLifecycleServerWideCheckers(t *testing.T) {
+	var failing atomic.Bool
+	conn, _, _ := startLifecycle(t, &testService{}, func(l *Lifecycle) {
+		l.AddChecker("", HealthCheckerFunc(func(ctx context.Context) error {
+			if failing.Load() {
+				return errors.New("disk full")
+			}
+			return nil
+		}))
+	})
+	failing.Store(true)
+	assert.Eventually(t, func() bool {
+		return healthStatus(t, conn, "") == healthpb.HealthCheckResponse_NOT_SERVING
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, healthStatus(t, conn, "grpc.testing.TestService"))
+}
+
+func TestLifecyclePreDrainDelay(t *testing.T) {
+	conn, cancel, done := startLifecycle(t, &testService{}, func(l *Lifecycle) { l.PreDrainDelay = 100 * time.Millisecond })
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, healthStatus(t, conn, ""))
+	cancel()
+
+	// Still serving (but reporting NOT_SERVING) during the delay
+	assert.Eventually(t, func() bool {
+		return healthStatus(t, conn, "") == healthpb.HealthCheckResponse_NOT_SERVING
+	}, 50*time.Millisecond, 5*time.Millisecond)
+	_, err := testpb.NewTestServiceClient(conn).UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Nil(t, err)
+	assert.Nil(t, <-done)
+}
+
+func TestLifecycleDrainsInFlightRequests(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	svc := &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		close(started)
+		<-release
+		return &testpb.SimpleResponse{Username: "done"}, nil
+	}}
+	conn, cancel, done := startLifecycle(t, svc, func(l *Lifecycle) { l.DrainTimeout = time.Second })
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := testpb.NewTestServiceClient(conn).UnaryCall(context.Background(), &testpb.SimpleRequest{})
+		result <- err
+	}()
+	<-started
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	assert.Nil(t, <-result)
+	assert.Nil(t, <-done)
+}
+
+func TestLifecycleDrainTimeout(t *testing.T) {
+	started := make(chan struct{})
+	svc := &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+	conn, cancel, done := startLifecycle(t, svc, func(l *Lifecycle) { l.DrainTimeout = 20 * time.Millisecond })
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := testpb.NewTestServiceClient(conn).UnaryCall(context.Background(), &testpb.SimpleRequest{})
+		result <- err
+	}()
+	<-started
+	start := time.Now()
+	cancel()
+	assert.Nil(t, <-done)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, codes.Unavailable, status.Code(<-result))
+}
+
+func TestDirWritableChecker(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, DirWritableChecker(dir).Check(context.Background()))
+	assert.NotNil(t, DirWritableChecker(filepath.Join(dir, "missing")).Check(context.Background()))
+	assert.Nil(t, StorageWritableChecker(storage.NewFileStorage(dir)).Check(context.Background()))
+}
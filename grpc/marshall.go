@@ -1,26 +1,320 @@
 package grpc
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
 
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
-var marshalOptions = protojson.MarshalOptions{
+// Marshaller converts proto messages to and from JSON.
+type Marshaller struct {
+	// Indentation for multi line output.  Empty for compact output
+	Indent string
+
+	// Emit fields with default values
+	EmitUnpopulated bool
+
+	// Use the proto field names instead of lowerCamelCase JSON names
+	UseProtoNames bool
+
+	// Ignore unknown fields when unmarshalling
+	DiscardUnknown bool
+
+	// Resolves types in google.protobuf.Any fields and extensions.  Defaults
+	// to protoregistry.GlobalTypes.
+	Resolver interface {
+		protoregistry.ExtensionTypeResolver
+		protoregistry.MessageTypeResolver
+	}
+}
+
+// DefaultMarshaller is used by DefaultProtoFormat and DefaultProtoToJson.
+var DefaultMarshaller = &Marshaller{
 	Indent:          "  ",
 	EmitUnpopulated: true,
 	UseProtoNames:   true,
 }
 
+var errNilMessage = errors.New("cannot marshal nil message")
+
+func (m *Marshaller) marshalOptions() protojson.MarshalOptions {
+	return protojson.MarshalOptions{
+		Indent:          m.Indent,
+		EmitUnpopulated: m.EmitUnpopulated,
+		UseProtoNames:   m.UseProtoNames,
+		Resolver:        m.Resolver,
+	}
+}
+
+func (m *Marshaller) unmarshalOptions() protojson.UnmarshalOptions {
+	return protojson.UnmarshalOptions{
+		DiscardUnknown: m.DiscardUnknown,
+		Resolver:       m.Resolver,
+	}
+}
+
+// Marshal converts a message to JSON.  Returns an error for nil messages.
+func (m *Marshaller) Marshal(msg protoreflect.ProtoMessage) ([]byte, error) {
+	if msg == nil {
+		return nil, errNilMessage
+	}
+	return m.marshalOptions().Marshal(msg)
+}
+
+// Unmarshal parses JSON into a message.
+func (m *Marshaller) Unmarshal(data []byte, msg protoreflect.ProtoMessage) error {
+	if msg == nil {
+		return errNilMessage
+	}
+	return m.unmarshalOptions().Unmarshal(data, msg)
+}
+
+// Format returns a message as JSON for display (eg in logs).  Errors are
+// ignored so this should not be used for serialization.
+func (m *Marshaller) Format(msg protoreflect.ProtoMessage) string {
+	return m.marshalOptions().Format(msg)
+}
+
+// MarshalList encodes a list of messages as a JSON array.
+func MarshalList[T proto.Message](m *Marshaller, msgs []T) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, msg := range msgs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if m.Indent != "" {
+			buf.WriteByte('\n')
+		}
+		data, err := m.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	if m.Indent != "" && len(msgs) > 0 {
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// WriteNDJSON writes messages as newline delimited JSON, one message per
+// line.  Messages are always written compactly regardless of Indent.
+func WriteNDJSON[T proto.Message](m *Marshaller, w io.Writer, msgs []T) error {
+	compact := *m
+	compact.Indent = ""
+	for _, msg := range msgs {
+		data, err := compact.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		// protojson can emit a space between tokens even in compact mode but
+		// never a newline, so lines stay intact
+		data = append(data, '\n')
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func DefaultProtoFormat(msg protoreflect.ProtoMessage) string {
-	return marshalOptions.Format(msg)
+	return DefaultMarshaller.Format(msg)
 }
 
+// DefaultProtoToJson marshals a message with the DefaultMarshaller.  Panics
+// on nil messages and ignores marshal errors - use DefaultMarshaller.Marshal
+// to handle errors.
 func DefaultProtoToJson(msg protoreflect.ProtoMessage) []byte {
 	if msg == nil {
-		panic(errors.New("Cnanot marshall nil"))
+		panic(errNilMessage)
 	}
-	jsonData, _ := marshalOptions.Marshal(msg)
+	jsonData, _ := DefaultMarshaller.Marshal(msg)
 	return jsonData
 }
+
+// ChangeKind is the kind of a Change reported by DiffProtos.
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeRemoved  ChangeKind = "removed"
+	ChangeModified ChangeKind = "modified"
+)
+
+// Change is a single difference between two messages.
+type Change struct {
+	// Path of the changed field, eg "payload.body", "items[2]" or
+	// `labels["env"]`.
+	Path string
+	Kind ChangeKind
+
+	// Old and new values (nil for added and removed values respectively).
+	// Messages are proto.Message, enums are their protoreflect.Name value
+	// names and all other values are their Go equivalents.
+	Old any
+	New any
+}
+
+// DiffProtos compares two messages of the same type and returns the changes
+// that turn a into b.  Nested messages are compared field by field, repeated
+// fields element by element (by index) and maps key by key.
+func DiffProtos(a proto.Message, b proto.Message) ([]Change, error) {
+	am, bm := a.ProtoReflect(), b.ProtoReflect()
+	if am.Descriptor().FullName() != bm.Descriptor().FullName() {
+		return nil, fmt.Errorf("cannot diff %s with %s", am.Descriptor().FullName(), bm.Descriptor().FullName())
+	}
+	var changes []Change
+	diffMessages(am, bm, "", &changes)
+	return changes, nil
+}
+
+// FormatChanges renders changes one value per line, unified diff style.  Old
+// values are prefixed with "- " and new values with "+ ", followed by the
+// path and the value, eg "+ items[2]: {"name":"new"}".  Messages are
+// rendered as compact JSON and enums as bare value names, as in protojson.
+func FormatChanges(changes []Change) string {
+	var sb strings.Builder
+	for _, change := range changes {
+		if change.Kind != ChangeAdded {
+			fmt.Fprintf(&sb, "- %s: %s\n", change.Path, formatChangeValue(change.Old))
+		}
+		if change.Kind != ChangeRemoved {
+			fmt.Fprintf(&sb, "+ %s: %s\n", change.Path, formatChangeValue(change.New))
+		}
+	}
+	return sb.String()
+}
+
+// DiffProtosString returns the FormatChanges rendering of the diff between
+// two messages, eg for test failure messages.  Empty if they are equal.
+func DiffProtosString(a proto.Message, b proto.Message) string {
+	changes, err := DiffProtos(a, b)
+	if err != nil {
+		return err.Error()
+	}
+	return FormatChanges(changes)
+}
+
+func diffMessages(a protoreflect.Message, b protoreflect.Message, prefix string, changes *[]Change) {
+	fields := a.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		hasA, hasB := a.Has(fd), b.Has(fd)
+		if !hasA && !hasB {
+			continue
+		}
+		path := prefix + string(fd.Name())
+		switch {
+		case fd.IsList():
+			diffLists(fd, a.Get(fd).List(), b.Get(fd).List(), path, changes)
+		case fd.IsMap():
+			diffMaps(fd, a.Get(fd).Map(), b.Get(fd).Map(), path, changes)
+		case !hasA && fd.HasPresence():
+			*changes = append(*changes, Change{Path: path, Kind: ChangeAdded, New: changeValue(fd, b.Get(fd))})
+		case !hasB && fd.HasPresence():
+			*changes = append(*changes, Change{Path: path, Kind: ChangeRemoved, Old: changeValue(fd, a.Get(fd))})
+		default:
+			diffValues(fd, a.Get(fd), b.Get(fd), path, changes)
+		}
+	}
+}
+
+// diffValues compares two singular values, recursing into messages.
+func diffValues(fd protoreflect.FieldDescriptor, a protoreflect.Value, b protoreflect.Value, path string, changes *[]Change) {
+	if fd.Message() != nil {
+		diffMessages(a.Message(), b.Message(), path+".", changes)
+	} else if !singularValuesEqual(fd, a, b) {
+		*changes = append(*changes, Change{Path: path, Kind: ChangeModified, Old: changeValue(fd, a), New: changeValue(fd, b)})
+	}
+}
+
+func diffLists(fd protoreflect.FieldDescriptor, a protoreflect.List, b protoreflect.List, path string, changes *[]Change) {
+	for i := 0; i < max(a.Len(), b.Len()); i++ {
+		elemPath := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case i >= a.Len():
+			*changes = append(*changes, Change{Path: elemPath, Kind: ChangeAdded, New: changeValue(fd, b.Get(i))})
+		case i >= b.Len():
+			*changes = append(*changes, Change{Path: elemPath, Kind: ChangeRemoved, Old: changeValue(fd, a.Get(i))})
+		default:
+			diffValues(fd, a.Get(i), b.Get(i), elemPath, changes)
+		}
+	}
+}
+
+func diffMaps(fd protoreflect.FieldDescriptor, a protoreflect.Map, b protoreflect.Map, path string, changes *[]Change) {
+	keys := make(map[string]protoreflect.MapKey)
+	collect := func(key protoreflect.MapKey, _ protoreflect.Value) bool {
+		keys[formatMapKey(key)] = key
+		return true
+	}
+	a.Range(collect)
+	b.Range(collect)
+	sortedKeys := make([]string, 0, len(keys))
+	for k := range keys {
+		sortedKeys = append(sortedKeys, k)
+	}
+	sort.Strings(sortedKeys)
+
+	valueFd := fd.MapValue()
+	for _, k := range sortedKeys {
+		key := keys[k]
+		entryPath := fmt.Sprintf("%s[%s]", path, k)
+		switch {
+		case !a.Has(key):
+			*changes = append(*changes, Change{Path: entryPath, Kind: ChangeAdded, New: changeValue(valueFd, b.Get(key))})
+		case !b.Has(key):
+			*changes = append(*changes, Change{Path: entryPath, Kind: ChangeRemoved, Old: changeValue(valueFd, a.Get(key))})
+		default:
+			diffValues(valueFd, a.Get(key), b.Get(key), entryPath, changes)
+		}
+	}
+}
+
+func formatMapKey(key protoreflect.MapKey) string {
+	if s, ok := key.Interface().(string); ok {
+		return strconv.Quote(s)
+	}
+	return key.String()
+}
+
+// changeValue converts a singular value into what is reported in a Change.
+func changeValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) any {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return v.Message().Interface()
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return ev.Name()
+		}
+		return int32(v.Enum())
+	default:
+		return v.Interface()
+	}
+}
+
+var compactMarshaller = &Marshaller{}
+
+func formatChangeValue(value any) string {
+	switch v := value.(type) {
+	case proto.Message:
+		return compactMarshaller.Format(v)
+	case string:
+		return strconv.Quote(v)
+	case []byte:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
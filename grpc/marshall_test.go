@@ -0,0 +1,207 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestMarshaller(t *testing.T) {
+	msg := &testpb.SimpleRequest{ResponseSize: 10, FillUsername: true}
+
+	data, err := DefaultMarshaller.Marshal(msg)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"response_size"`)
+	assert.Contains(t, string(data), `"fill_oauth_scope"`) // unpopulated fields are emitted
+	assert.Equal(t, data, DefaultProtoToJson(msg))
+
+	camel := &Marshaller{}
+	data, err = camel.Marshal(msg)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"responseSize"`)
+	assert.NotContains(t, string(data), `"fillOauthScope"`)
+	assert.NotContains(t, string(data), "\n")
+
+	_, err = camel.Marshal(nil)
+	assert.NotNil(t, err)
+	assert.Panics(t, func() { DefaultProtoToJson(nil) })
+
+	var parsed testpb.SimpleRequest
+	assert.NotNil(t, camel.Unmarshal([]byte(`{"responseSize": 5, "unknown": 1}`), &parsed))
+	lenient := &Marshaller{DiscardUnknown: true}
+	assert.Nil(t, lenient.Unmarshal([]byte(`{"responseSize": 5, "unknown": 1}`), &parsed))
+	assert.Equal(t, int32(5), parsed.ResponseSize)
+
+	// Any fields are resolved through the resolver
+	packed, err := anypb.New(wrapperspb.String("hello"))
+	assert.Nil(t, err)
+	data, err = camel.Marshal(packed)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "google.protobuf.StringValue")
+}
+
+func TestMarshallerResolver(t *testing.T) {
+	// A type only known to a custom registry
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("custom.proto"),
+		Package: proto.String("custom"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Note"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("text"),
+				JsonName: proto.String("text"),
+				Number:   proto.Int32(1),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}},
+		}},
+	}, protoregistry.GlobalFiles)
+	assert.Nil(t, err)
+	noteType := dynamicpb.NewMessageType(fd.Messages().ByName("Note"))
+	types := &protoregistry.Types{}
+	assert.Nil(t, types.RegisterMessage(noteType))
+
+	note := noteType.New()
+	note.Set(noteType.Descriptor().Fields().ByName("text"), protoreflect.ValueOfString("hello"))
+	packed := &anypb.Any{}
+	assert.Nil(t, packed.MarshalFrom(note.Interface()))
+
+	// The global registry cannot resolve it
+	_, err = (&Marshaller{}).Marshal(packed)
+	assert.NotNil(t, err)
+
+	custom := &Marshaller{Resolver: types}
+	data, err := custom.Marshal(packed)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"@type": "type.googleapis.com/custom.Note", "text": "hello"}`, string(data))
+
+	var parsed anypb.Any
+	assert.Nil(t, custom.Unmarshal(data, &parsed))
+	assert.Equal(t, packed.Value, parsed.Value)
+
+	// Resolution failures are returned
+	empty := &Marshaller{Resolver: &protoregistry.Types{}}
+	_, err = empty.Marshal(packed)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "custom.Note")
+	assert.NotNil(t, empty.Unmarshal(data, &parsed))
+}
+
+func TestMarshalLists(t *testing.T) {
+	msgs := []*testpb.Payload{{Body: []byte("a")}, {Body: []byte("b")}}
+
+	for _, m := range []*Marshaller{DefaultMarshaller, {}} {
+		data, err := MarshalList(m, msgs)
+		assert.Nil(t, err)
+		var decoded []map[string]any
+		assert.Nil(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, 2, len(decoded))
+	}
+	data, err := MarshalList(DefaultMarshaller, []*testpb.Payload{})
+	assert.Nil(t, err)
+	assert.Equal(t, "[]", string(data))
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteNDJSON(DefaultMarshaller, &buf, msgs))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	var parsed testpb.Payload
+	assert.Nil(t, DefaultMarshaller.Unmarshal([]byte(lines[1]), &parsed))
+	assert.Equal(t, "b", string(parsed.Body))
+}
+
+func TestDiffProtosScalarsAndMessages(t *testing.T) {
+	a := &testpb.SimpleRequest{
+		ResponseSize: 1,
+		Payload:      &testpb.Payload{Body: []byte("old")},
+	}
+	b := &testpb.SimpleRequest{
+		ResponseSize: 2,
+		FillUsername: true,
+		Payload:      &testpb.Payload{Body: []byte("new")},
+	}
+	changes, err := DiffProtos(a, b)
+	assert.Nil(t, err)
+	assert.Equal(t, []Change{
+		{Path: "response_size", Kind: ChangeModified, Old: int32(1), New: int32(2)},
+		{Path: "payload.body", Kind: ChangeModified, Old: []byte("old"), New: []byte("new")},
+		{Path: "fill_username", Kind: ChangeModified, Old: false, New: true},
+	}, changes)
+
+	changes, _ = DiffProtos(&testpb.SimpleRequest{}, &testpb.SimpleRequest{Payload: &testpb.Payload{}})
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, ChangeAdded, changes[0].Kind)
+	assert.Equal(t, "payload", changes[0].Path)
+
+	changes, _ = DiffProtos(b, b)
+	assert.Empty(t, changes)
+
+	_, err = DiffProtos(a, &testpb.Payload{})
+	assert.NotNil(t, err)
+}
+
+func TestDiffProtosListsAndMaps(t *testing.T) {
+	a := &testpb.StreamingOutputCallRequest{
+		ResponseParameters: []*testpb.ResponseParameters{{Size: 1}, {Size: 2}, {Size: 3}},
+	}
+	b := &testpb.StreamingOutputCallRequest{
+		ResponseParameters: []*testpb.ResponseParameters{{Size: 1}, {Size: 5}},
+	}
+	changes, _ := DiffProtos(a, b)
+	assert.Equal(t, 2, len(changes))
+	assert.Equal(t, "response_parameters[1].size", changes[0].Path)
+	assert.Equal(t, ChangeModified, changes[0].Kind)
+	assert.Equal(t, "response_parameters[2]", changes[1].Path)
+	assert.Equal(t, ChangeRemoved, changes[1].Kind)
+
+	sa, _ := structpb.NewStruct(map[string]any{"keep": "x", "change": 1, "drop": true})
+	sb, _ := structpb.NewStruct(map[string]any{"keep": "x", "change": 2, "add": "y"})
+	changes, _ = DiffProtos(sa, sb)
+	paths := make([]string, len(changes))
+	for i, change := range changes {
+		paths[i] = change.Path
+	}
+	assert.Equal(t, []string{`fields["add"]`, `fields["change"].number_value`, `fields["drop"]`}, paths)
+	assert.Equal(t, ChangeAdded, changes[0].Kind)
+	assert.Equal(t, ChangeRemoved, changes[2].Kind)
+}
+
+func TestFormatChanges(t *testing.T) {
+	a := &testpb.SimpleRequest{ResponseSize: 1}
+	b := &testpb.SimpleRequest{ResponseSize: 2, Payload: &testpb.Payload{Body: []byte("hi")}}
+	assert.Equal(t, `- response_size: 1
++ response_size: 2
++ payload: {"body":"aGk="}
+`, DiffProtosString(a, b))
+	assert.Equal(t, "", DiffProtosString(a, a))
+
+	changes := []Change{{Path: "name", Kind: ChangeModified, Old: "a", New: "COMPRESSABLE"}}
+	assert.Equal(t, "- name: \"a\"\n+ name: \"COMPRESSABLE\"\n", FormatChanges(changes))
+}
+
+func TestDiffProtosEnums(t *testing.T) {
+	a := &testpb.SimpleResponse{GrpclbRouteType: testpb.GrpclbRouteType_GRPCLB_ROUTE_TYPE_FALLBACK}
+	b := &testpb.SimpleResponse{GrpclbRouteType: testpb.GrpclbRouteType_GRPCLB_ROUTE_TYPE_BACKEND}
+	changes, err := DiffProtos(a, b)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, protoreflect.Name("GRPCLB_ROUTE_TYPE_FALLBACK"), changes[0].Old)
+
+	// Enums are rendered as bare value names
+	assert.Equal(t, "- grpclb_route_type: GRPCLB_ROUTE_TYPE_FALLBACK\n+ grpclb_route_type: GRPCLB_ROUTE_TYPE_BACKEND\n",
+		FormatChanges(changes))
+}
@@ -0,0 +1,241 @@
+package grpc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error that RPCs whose handlers panic are recorded with
+var errPanicked = status.Error(codes.Internal, "handler panicked")
+
+// Default latency histogram buckets (in seconds)
+var DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics collects per method request counts, in-flight requests and latency
+// histograms from its interceptors and serves them in the Prometheus text
+// exposition format as an http.Handler (eg mounted on /metrics).
+type Metrics struct {
+	mu      sync.Mutex
+	buckets []float64
+	methods map[methodLabels]*methodMetrics
+}
+
+type methodLabels struct {
+	rpcType string
+	service string
+	method  string
+}
+
+type methodMetrics struct {
+	started  int64
+	inFlight int64
+	handled  map[codes.Code]int64
+
+	// Cumulative counts per bucket (plus +Inf) along with the sum of latencies
+	latencyCounts []int64
+	latencySum    float64
+}
+
+// NewMetrics creates a Metrics with the given latency buckets in seconds.
+// Uses DefaultLatencyBuckets if none are given.
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{buckets: buckets, methods: make(map[methodLabels]*methodMetrics)}
+}
+
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+		labels := newMethodLabels("unary", info.FullMethod)
+		start := m.onStart(labels)
+		defer func() {
+			// Panics are recorded as Internal (which is what ErrorLogger
+			// turns them into) before being passed on
+			if p := recover(); p != nil {
+				m.onFinish(labels, start, errPanicked)
+				panic(p)
+			}
+			m.onFinish(labels, start, err)
+		}()
+		return handler(ctx, req)
+	}
+}
+
+func (m *Metrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+		rpcType := "bidi_stream"
+		if !info.IsClientStream {
+			rpcType = "server_stream"
+		} else if !info.IsServerStream {
+			rpcType = "client_stream"
+		}
+		labels := newMethodLabels(rpcType, info.FullMethod)
+		start := m.onStart(labels)
+		defer func() {
+			// Panics are recorded as Internal (which is what ErrorLogger
+			// turns them into) before being passed on
+			if p := recover(); p != nil {
+				m.onFinish(labels, start, errPanicked)
+				panic(p)
+			}
+			m.onFinish(labels, start, err)
+		}()
+		return handler(srv, ss)
+	}
+}
+
+func newMethodLabels(rpcType string, fullMethod string) methodLabels {
+	service, method := splitFullMethod(fullMethod)
+	return methodLabels{rpcType: rpcType, service: service, method: method}
+}
+
+// splitFullMethod splits "/package.Service/Method" into its service and method.
+func splitFullMethod(fullMethod string) (service string, method string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
+
+func (m *Metrics) onStart(labels methodLabels) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mm := m.methods[labels]
+	if mm == nil {
+		mm = &methodMetrics{handled: make(map[codes.Code]int64), latencyCounts: make([]int64, len(m.buckets)+1)}
+		m.methods[labels] = mm
+	}
+	mm.started++
+	mm.inFlight++
+	return time.Now()
+}
+
+func (m *Metrics) onFinish(labels methodLabels, start time.Time, err error) {
+	elapsed := time.Since(start).Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mm := m.methods[labels]
+	mm.inFlight--
+	mm.handled[status.Code(err)]++
+	mm.latencySum += elapsed
+	for i, bound := range m.buckets {
+		if elapsed <= bound {
+			mm.latencyCounts[i]++
+		}
+	}
+	mm.latencyCounts[len(m.buckets)]++
+}
+
+// snapshot copies the metrics of every method so they can be written out
+// without holding the lock.
+func (m *Metrics) snapshot() map[methodLabels]*methodMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[methodLabels]*methodMetrics, len(m.methods))
+	for labels, mm := range m.methods {
+		copied := *mm
+		copied.handled = make(map[codes.Code]int64, len(mm.handled))
+		for code, count := range mm.handled {
+			copied.handled[code] = count
+		}
+		copied.latencyCounts = append([]int64(nil), mm.latencyCounts...)
+		out[labels] = &copied
+	}
+	return out
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+// Metrics are copied first so slow scrapers do not hold up RPCs.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	methods := m.snapshot()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	labelsList := make([]methodLabels, 0, len(methods))
+	for labels := range methods {
+		labelsList = append(labelsList, labels)
+	}
+	sort.Slice(labelsList, func(i, j int) bool {
+		a, b := labelsList[i], labelsList[j]
+		if a.service != b.service {
+			return a.service < b.service
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.rpcType < b.rpcType
+	})
+
+	fmt.Fprintln(out, "# HELP grpc_server_started_total Total number of RPCs started on the server.")
+	fmt.Fprintln(out, "# TYPE grpc_server_started_total counter")
+	for _, labels := range labelsList {
+		fmt.Fprintf(out, "grpc_server_started_total{%s} %d\n", labels.format(), methods[labels].started)
+	}
+
+	fmt.Fprintln(out, "# HELP grpc_server_handled_total Total number of RPCs completed on the server, regardless of success or failure.")
+	fmt.Fprintln(out, "# TYPE grpc_server_handled_total counter")
+	for _, labels := range labelsList {
+		handled := methods[labels].handled
+		codeList := make([]codes.Code, 0, len(handled))
+		for code := range handled {
+			codeList = append(codeList, code)
+		}
+		sort.Slice(codeList, func(i, j int) bool { return codeList[i] < codeList[j] })
+		for _, code := range codeList {
+			fmt.Fprintf(out, "grpc_server_handled_total{%s,grpc_code=\"%s\"} %d\n", labels.format(), code.String(), handled[code])
+		}
+	}
+
+	fmt.Fprintln(out, "# HELP grpc_server_in_flight Number of RPCs currently being handled by the server.")
+	fmt.Fprintln(out, "# TYPE grpc_server_in_flight gauge")
+	for _, labels := range labelsList {
+		fmt.Fprintf(out, "grpc_server_in_flight{%s} %d\n", labels.format(), methods[labels].inFlight)
+	}
+
+	fmt.Fprintln(out, "# HELP grpc_server_handling_seconds Histogram of response latency (seconds) of RPCs handled by the server.")
+	fmt.Fprintln(out, "# TYPE grpc_server_handling_seconds histogram")
+	for _, labels := range labelsList {
+		mm := methods[labels]
+		for i, bound := range m.buckets {
+			fmt.Fprintf(out, "grpc_server_handling_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels.format(), strconv.FormatFloat(bound, 'g', -1, 64), mm.latencyCounts[i])
+		}
+		total := mm.latencyCounts[len(m.buckets)]
+		fmt.Fprintf(out, "grpc_server_handling_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels.format(), total)
+		fmt.Fprintf(out, "grpc_server_handling_seconds_sum{%s} %s\n", labels.format(), strconv.FormatFloat(mm.latencySum, 'g', -1, 64))
+		fmt.Fprintf(out, "grpc_server_handling_seconds_count{%s} %d\n", labels.format(), total)
+	}
+}
+
+func (l methodLabels) format() string {
+	return fmt.Sprintf("grpc_type=\"%s\",grpc_service=\"%s\",grpc_method=\"%s\"",
+		escapeLabelValue(l.rpcType), escapeLabelValue(l.service), escapeLabelValue(l.method))
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
@@ -0,0 +1,69 @@
+package grpc
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics(0.5, 0.1)
+	fail := false
+	svc := &testService{
+		unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+			if fail {
+				return nil, status.Error(codes.NotFound, "missing")
+			}
+			return &testpb.SimpleResponse{}, nil
+		},
+	}
+	conn := startTestServer(t, svc, []grpc.ServerOption{
+		grpc.UnaryInterceptor(metrics.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(metrics.StreamServerInterceptor()),
+	})
+	client := testpb.NewTestServiceClient(conn)
+	client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	fail = true
+	client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	stream, _ := client.StreamingOutputCall(context.Background(), &testpb.StreamingOutputCallRequest{})
+	stream.Recv()
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	assert.Contains(t, rec.Header().Get("Content-Type"), "version=0.0.4")
+
+	unary := `grpc_type="unary",grpc_service="grpc.testing.TestService",grpc_method="UnaryCall"`
+	assert.Contains(t, body, "# TYPE grpc_server_handled_total counter\n")
+	assert.Contains(t, body, "grpc_server_started_total{"+unary+"} 3\n")
+	assert.Contains(t, body, "grpc_server_handled_total{"+unary+`,grpc_code="OK"} 2`+"\n")
+	assert.Contains(t, body, "grpc_server_handled_total{"+unary+`,grpc_code="NotFound"} 1`+"\n")
+	assert.Contains(t, body, "grpc_server_in_flight{"+unary+"} 0\n")
+	assert.Contains(t, body, "grpc_server_handling_seconds_bucket{"+unary+`,le="0.1"} 3`+"\n")
+	assert.Contains(t, body, "grpc_server_handling_seconds_bucket{"+unary+`,le="+Inf"} 3`+"\n")
+	assert.Contains(t, body, "grpc_server_handling_seconds_count{"+unary+"} 3\n")
+	assert.Contains(t, body, `grpc_server_started_total{grpc_type="server_stream",grpc_service="grpc.testing.TestService",grpc_method="StreamingOutputCall"} 1`)
+}
+
+func TestMetricsRecordsPanicsAsInternal(t *testing.T) {
+	metrics := NewMetrics()
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Method"}
+	assert.Panics(t, func() {
+		metrics.UnaryServerInterceptor()(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+			panic("boom")
+		})
+	})
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	assert.Contains(t, body, `grpc_server_handled_total{grpc_type="unary",grpc_service="pkg.Service",grpc_method="Method",grpc_code="Internal"} 1`)
+	assert.Contains(t, body, `grpc_server_in_flight{grpc_type="unary",grpc_service="pkg.Service",grpc_method="Method"} 0`)
+}
@@ -0,0 +1,316 @@
+package grpc
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Key used with SetMethodLimit/SetClientLimit to set the default limit for
+// all methods/clients that do not have one of their own.
+const DefaultLimitKey = "*"
+
+// Default cap on the number of client buckets a RateLimiter keeps (see
+// RateLimiter.SetMaxBuckets)
+const DefaultMaxRateLimitBuckets = 10000
+
+// RateLimit configures a token bucket.  A zero Rate means no limit.
+type RateLimit struct {
+	// Tokens added per second
+	Rate float64
+
+	// Maximum tokens the bucket can hold (ie the largest burst allowed).
+	// Treated as 1 if not set.
+	Burst int
+}
+
+// BucketState is a snapshot of a single token bucket.
+type BucketState struct {
+	// "method" or "client"
+	Kind string
+
+	// Method name or client key the bucket belongs to
+	Key string
+
+	Limit    RateLimit
+	Tokens   float64
+	LastUsed time.Time
+}
+
+// RateLimiter enforces token bucket limits on RPCs per method (shared by all
+// clients) and per client (across all methods).  Limits can be changed at
+// any time.  Requests over a limit fail with codes.ResourceExhausted carrying
+// a RetryInfo detail with how long to wait before retrying.
+type RateLimiter struct {
+	mu           sync.Mutex
+	clientKey    func(ctx context.Context) string
+	methodLimits map[string]RateLimit
+	clientLimits map[string]RateLimit
+	buckets      map[string]*tokenBucket
+	lastPrune    time.Time
+
+	// Client buckets ordered by most recent use, for evicting once there are
+	// more than maxBuckets.  Method buckets are bounded by the server's
+	// methods so are never evicted.
+	lru        *list.List
+	maxBuckets int
+}
+
+type tokenBucket struct {
+	elem     *list.Element
+	kind     string
+	key      string
+	limit    RateLimit
+	tokens   float64
+	refilled time.Time
+	lastUsed time.Time
+}
+
+// NewRateLimiter creates a RateLimiter identifying clients with clientKey.
+// Defaults to PeerAddressKey if clientKey is nil.
+func NewRateLimiter(clientKey func(ctx context.Context) string) *RateLimiter {
+	if clientKey == nil {
+		clientKey = PeerAddressKey
+	}
+	return &RateLimiter{
+		clientKey:    clientKey,
+		methodLimits: make(map[string]RateLimit),
+		clientLimits: make(map[string]RateLimit),
+		buckets:      make(map[string]*tokenBucket),
+		lru:          list.New(),
+		maxBuckets:   DefaultMaxRateLimitBuckets,
+	}
+}
+
+// SetMaxBuckets caps the number of client buckets kept, evicting the least
+// recently used ones beyond it.  Client keys often come from request metadata so
+// without a cap clients rotating their key could grow the buckets without
+// bound.  An evicted client starts again with a full bucket.
+func (r *RateLimiter) SetMaxBuckets(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxBuckets = max(1, n)
+	r.evict()
+}
+
+// PeerAddressKey identifies clients by the host of their peer address.
+func PeerAddressKey(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// MetadataKey identifies clients by the value of an incoming metadata key
+// (eg an api key header).
+func MetadataKey(key string) func(ctx context.Context) string {
+	return func(ctx context.Context) string {
+		if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+}
+
+// SetMethodLimit sets the limit for a full method name (or DefaultLimitKey).
+// A zero RateLimit removes the limit.
+func (r *RateLimiter) SetMethodLimit(method string, limit RateLimit) {
+	r.setLimit(r.methodLimits, "method", method, limit)
+}
+
+// SetClientLimit sets the limit for a client key (or DefaultLimitKey).  A
+// zero RateLimit removes the limit.
+func (r *RateLimiter) SetClientLimit(client string, limit RateLimit) {
+	r.setLimit(r.clientLimits, "client", client, limit)
+}
+
+func (r *RateLimiter) setLimit(limits map[string]RateLimit, kind string, key string, limit RateLimit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if limit.Rate <= 0 {
+		delete(limits, key)
+	} else {
+		limit.Burst = max(1, limit.Burst)
+		limits[key] = limit
+	}
+	// Existing buckets pick up the new limit straight away
+	for _, bucket := range r.buckets {
+		if bucket.kind == kind && (key == DefaultLimitKey || bucket.key == key) {
+			bucket.refill(time.Now())
+			bucket.limit = r.limitFor(limits, bucket.key)
+		}
+	}
+}
+
+// Snapshot returns the current state of all active buckets.
+func (r *RateLimiter) Snapshot() []BucketState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	out := make([]BucketState, 0, len(r.buckets))
+	for _, bucket := range r.buckets {
+		bucket.refill(now)
+		out = append(out, BucketState{
+			Kind:     bucket.kind,
+			Key:      bucket.key,
+			Limit:    bucket.limit,
+			Tokens:   bucket.tokens,
+			LastUsed: bucket.lastUsed,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+// Allow takes a token for the method and client if both have one available.
+// Otherwise returns an error with how long to wait before retrying.
+func (r *RateLimiter) Allow(ctx context.Context, method string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Evict once the call is done with its buckets, which are then the most
+	// recently used so are kept
+	defer r.evict()
+
+	now := time.Now()
+	if now.Sub(r.lastPrune) > time.Minute {
+		r.prune(now)
+	}
+
+	var buckets []*tokenBucket
+	if limit := r.limitFor(r.methodLimits, method); limit.Rate > 0 {
+		buckets = append(buckets, r.bucket("method", method, limit, now))
+	}
+	client := r.clientKey(ctx)
+	if limit := r.limitFor(r.clientLimits, client); limit.Rate > 0 {
+		buckets = append(buckets, r.bucket("client", client, limit, now))
+	}
+
+	// Only take tokens if every bucket has one so a rejected request does
+	// not eat into the other limits
+	var retryAfter time.Duration
+	var exceeded []string
+	for _, bucket := range buckets {
+		bucket.refill(now)
+		if bucket.tokens < 1 {
+			wait := time.Duration(math.Ceil((1 - bucket.tokens) / bucket.limit.Rate * float64(time.Second)))
+			retryAfter = max(retryAfter, wait)
+			exceeded = append(exceeded, fmt.Sprintf("%s %s", bucket.kind, bucket.key))
+		}
+	}
+	if len(exceeded) > 0 {
+		st, _ := status.New(codes.ResourceExhausted, "rate limit exceeded for "+strings.Join(exceeded, ", ")).
+			WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+		return st.Err()
+	}
+	for _, bucket := range buckets {
+		bucket.tokens--
+		bucket.lastUsed = now
+	}
+	return nil
+}
+
+func (r *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if err := r.Allow(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (r *RateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		if err := r.Allow(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func (r *RateLimiter) limitFor(limits map[string]RateLimit, key string) RateLimit {
+	if limit, ok := limits[key]; ok {
+		return limit
+	}
+	return limits[DefaultLimitKey]
+}
+
+func (r *RateLimiter) bucket(kind string, key string, limit RateLimit, now time.Time) *tokenBucket {
+	bucketKey := kind + ":" + key
+	bucket := r.buckets[bucketKey]
+	if bucket == nil {
+		bucket = &tokenBucket{kind: kind, key: key, limit: limit, tokens: float64(limit.Burst), refilled: now, lastUsed: now}
+		if kind == "client" {
+			bucket.elem = r.lru.PushFront(bucketKey)
+		}
+		r.buckets[bucketKey] = bucket
+	} else if bucket.elem != nil {
+		r.lru.MoveToFront(bucket.elem)
+	}
+	return bucket
+}
+
+// evict drops the least recently used client buckets beyond maxBuckets.
+// The buckets used by the latest call are the most recently used so are
+// kept.
+func (r *RateLimiter) evict() {
+	for r.lru.Len() > r.maxBuckets {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.buckets, oldest.Value.(string))
+	}
+}
+
+// prune drops buckets that have refilled completely since they are no
+// different from new ones.  Keeps the per client buckets from growing forever.
+func (r *RateLimiter) prune(now time.Time) {
+	for key, bucket := range r.buckets {
+		bucket.refill(now)
+		if bucket.limit.Rate <= 0 || bucket.tokens >= float64(bucket.limit.Burst) {
+			if bucket.elem != nil {
+				r.lru.Remove(bucket.elem)
+			}
+			delete(r.buckets, key)
+		}
+	}
+	r.lastPrune = now
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if b.limit.Rate <= 0 {
+		b.refilled = now
+		return
+	}
+	elapsed := now.Sub(b.refilled).Seconds()
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+	b.refilled = now
+}
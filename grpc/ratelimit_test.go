@@ -0,0 +1,113 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(MetadataKey("x-api-key"))
+	limiter.SetMethodLimit("/grpc.testing.TestService/UnaryCall", RateLimit{Rate: 0.5, Burst: 3})
+	limiter.SetClientLimit(DefaultLimitKey, RateLimit{Rate: 0.5, Burst: 2})
+	conn := startTestServer(t, &testService{}, []grpc.ServerOption{
+		grpc.UnaryInterceptor(limiter.UnaryServerInterceptor()),
+	})
+	client := testpb.NewTestServiceClient(conn)
+	call := func(apiKey string) error {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", apiKey)
+		_, err := client.UnaryCall(ctx, &testpb.SimpleRequest{})
+		return err
+	}
+
+	// Client limit kicks in first
+	assert.Nil(t, call("alice"))
+	assert.Nil(t, call("alice"))
+	err := call("alice")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "client alice")
+
+	var retryInfo *errdetails.RetryInfo
+	for _, detail := range status.Convert(err).Details() {
+		if ri, ok := detail.(*errdetails.RetryInfo); ok {
+			retryInfo = ri
+		}
+	}
+	assert.NotNil(t, retryInfo)
+	assert.Greater(t, retryInfo.RetryDelay.AsDuration(), time.Second)
+
+	// Then the method limit shared by everyone
+	assert.Nil(t, call("bob"))
+	err = call("bob")
+	assert.Contains(t, status.Convert(err).Message(), "method /grpc.testing.TestService/UnaryCall")
+
+	// Rejected calls do not consume bob's client tokens
+	states := limiter.Snapshot()
+	assert.Equal(t, 3, len(states))
+	assert.Equal(t, "client", states[1].Kind)
+	assert.Equal(t, "bob", states[1].Key)
+	assert.InDelta(t, 1.0, states[1].Tokens, 0.1)
+
+	// Limits can be changed at runtime
+	limiter.SetMethodLimit("/grpc.testing.TestService/UnaryCall", RateLimit{})
+	assert.Nil(t, call("bob"))
+	limiter.SetClientLimit("carol", RateLimit{Rate: 0.5, Burst: 5})
+	for range 5 {
+		assert.Nil(t, call("carol"))
+	}
+	assert.NotNil(t, call("carol"))
+}
+
+func TestRateLimiterMaxBuckets(t *testing.T) {
+	limiter := NewRateLimiter(MetadataKey("x-api-key"))
+	limiter.SetClientLimit(DefaultLimitKey, RateLimit{Rate: 0.001, Burst: 1})
+	limiter.SetMaxBuckets(3)
+	allow := func(apiKey string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", apiKey))
+		return limiter.Allow(ctx, "/svc/Method")
+	}
+
+	// Rotating keys does not grow the buckets beyond the cap
+	assert.Nil(t, allow("a"))
+	for i := range 100 {
+		assert.Nil(t, allow(fmt.Sprintf("key-%d", i)))
+		assert.NotNil(t, allow("a"))
+	}
+	assert.Equal(t, 3, len(limiter.Snapshot()))
+
+	// The least recently used ones are evicted
+	assert.Nil(t, allow("b"))
+	assert.Nil(t, allow("c"))
+	var keys []string
+	for _, bucket := range limiter.Snapshot() {
+		keys = append(keys, bucket.Key)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, keys)
+}
+
+func TestRateLimiterMaxBucketsKeepsMethodLimits(t *testing.T) {
+	limiter := NewRateLimiter(MetadataKey("x-api-key"))
+	limiter.SetMethodLimit("/svc/Method", RateLimit{Rate: 0.001, Burst: 1})
+	limiter.SetClientLimit(DefaultLimitKey, RateLimit{Rate: 0.001, Burst: 1})
+	limiter.SetMaxBuckets(1)
+	allow := func(apiKey string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", apiKey))
+		return limiter.Allow(ctx, "/svc/Method")
+	}
+
+	// Client buckets are evicted but the method bucket is never reset
+	assert.Nil(t, allow("a"))
+	for i := range 5 {
+		assert.NotNil(t, allow(fmt.Sprintf("key-%d", i)))
+	}
+	assert.Equal(t, 2, len(limiter.Snapshot()))
+}
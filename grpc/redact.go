@@ -0,0 +1,174 @@
+package grpc
+
+import (
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Value string fields are replaced with when redacted
+const RedactedValue = "[REDACTED]"
+
+// Field names treated as sensitive by DefaultRedactor
+var SensitiveFieldNames = []string{
+	"password", "secret", "token", "access_token", "refresh_token", "id_token",
+	"api_key", "authorization", "private_key", "client_secret",
+	"credit_card", "card_number", "cvv", "ssn",
+}
+
+// DefaultRedactor redacts the SensitiveFieldNames (and anything registered
+// with RegisterSensitiveFields).  Used by ErrorLogger and RequestLogger when
+// no redact function is given.
+var DefaultRedactor = NewRedactor().AddNames(SensitiveFieldNames...)
+
+// RegisterSensitiveFields adds field names (matched at any depth) to
+// DefaultRedactor.
+func RegisterSensitiveFields(names ...string) {
+	DefaultRedactor.AddNames(names...)
+}
+
+// Redactor masks sensitive fields of messages before they are logged.
+// Fields are selected by proto name (at any depth), by full name (eg
+// "pkg.User.password") or by path from the root message (eg
+// "user.address.street", which applies to every element of repeated fields
+// and map values along the way).  String fields are replaced with
+// RedactedValue and all other fields are cleared.
+type Redactor struct {
+	mu        sync.RWMutex
+	names     map[protoreflect.Name]bool
+	fullNames map[protoreflect.FullName]bool
+	paths     map[string]bool
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{
+		names:     make(map[protoreflect.Name]bool),
+		fullNames: make(map[protoreflect.FullName]bool),
+		paths:     make(map[string]bool),
+	}
+}
+
+// AddNames redacts fields with these names in any message.  Names are
+// matched case insensitively.
+func (r *Redactor) AddNames(names ...string) *Redactor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		r.names[protoreflect.Name(strings.ToLower(name))] = true
+	}
+	return r
+}
+
+// AddFullNames redacts fields by their fully qualified names, eg
+// "pkg.User.password".
+func (r *Redactor) AddFullNames(fullNames ...string) *Redactor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range fullNames {
+		r.fullNames[protoreflect.FullName(name)] = true
+	}
+	return r
+}
+
+// AddPaths redacts fields by their "." separated path from the root message.
+func (r *Redactor) AddPaths(paths ...string) *Redactor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, path := range paths {
+		r.paths[path] = true
+	}
+	return r
+}
+
+// Redact returns a copy of msg with all selected fields masked.  msg itself
+// is not modified.
+func (r *Redactor) Redact(msg proto.Message) proto.Message {
+	if msg == nil {
+		return nil
+	}
+	out := proto.Clone(msg)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.redactMessage(out.ProtoReflect(), "")
+	return out
+}
+
+// RedactPayload redacts proto messages and returns anything else as is.  It
+// can be passed directly to WithRequestPayloads or RequestLoggerConfig.Redact.
+func (r *Redactor) RedactPayload(payload any) any {
+	if msg, ok := payload.(proto.Message); ok {
+		return r.Redact(msg)
+	}
+	return payload
+}
+
+// RedactJSON returns msg as JSON (with DefaultMarshaller) after redacting it.
+func (r *Redactor) RedactJSON(msg proto.Message) ([]byte, error) {
+	if msg == nil {
+		return nil, errNilMessage
+	}
+	return DefaultMarshaller.Marshal(r.Redact(msg))
+}
+
+// Format is DefaultProtoFormat for the redacted copy of msg.
+func (r *Redactor) Format(msg proto.Message) string {
+	return DefaultProtoFormat(r.Redact(msg))
+}
+
+func (r *Redactor) selected(fd protoreflect.FieldDescriptor, path string) bool {
+	return r.names[protoreflect.Name(strings.ToLower(string(fd.Name())))] || r.fullNames[fd.FullName()] || r.paths[path]
+}
+
+func (r *Redactor) redactMessage(m protoreflect.Message, prefix string) {
+	var fields []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+	for _, fd := range fields {
+		path := prefix + string(fd.Name())
+		if r.selected(fd, path) {
+			maskField(m, fd)
+			continue
+		}
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := m.Mutable(fd).List()
+			for i := 0; i < list.Len(); i++ {
+				r.redactMessage(list.Get(i).Message(), path+".")
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			m.Mutable(fd).Map().Range(func(_ protoreflect.MapKey, value protoreflect.Value) bool {
+				r.redactMessage(value.Message(), path+".")
+				return true
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Message() != nil:
+			r.redactMessage(m.Mutable(fd).Message(), path+".")
+		}
+	}
+}
+
+// maskField replaces strings (including those in repeated fields and map
+// values) with RedactedValue and clears everything else.
+func maskField(m protoreflect.Message, fd protoreflect.FieldDescriptor) {
+	redacted := protoreflect.ValueOfString(RedactedValue)
+	switch {
+	case fd.IsList() && fd.Kind() == protoreflect.StringKind:
+		list := m.Mutable(fd).List()
+		for i := 0; i < list.Len(); i++ {
+			list.Set(i, redacted)
+		}
+	case fd.IsMap() && fd.MapValue().Kind() == protoreflect.StringKind:
+		values := m.Mutable(fd).Map()
+		values.Range(func(key protoreflect.MapKey, _ protoreflect.Value) bool {
+			values.Set(key, redacted)
+			return true
+		})
+	case !fd.IsList() && !fd.IsMap() && fd.Kind() == protoreflect.StringKind:
+		m.Set(fd, redacted)
+	default:
+		m.Clear(fd)
+	}
+}
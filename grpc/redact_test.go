@@ -0,0 +1,106 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestRedactorSelectors(t *testing.T) {
+	req := &testpb.SimpleRequest{
+		ResponseSize:   10,
+		Payload:        &testpb.Payload{Body: []byte("secret body")},
+		ResponseStatus: &testpb.EchoStatus{Code: 3, Message: "card 1234"},
+	}
+	r := NewRedactor().
+		AddFullNames("grpc.testing.Payload.body").
+		AddPaths("response_status.message")
+	redacted := r.Redact(req).(*testpb.SimpleRequest)
+	assert.Nil(t, redacted.Payload.Body)
+	assert.Equal(t, RedactedValue, redacted.ResponseStatus.Message)
+	assert.Equal(t, int32(3), redacted.ResponseStatus.Code)
+	assert.Equal(t, int32(10), redacted.ResponseSize)
+
+	// The original is untouched
+	assert.Equal(t, "secret body", string(req.Payload.Body))
+	assert.Equal(t, "card 1234", req.ResponseStatus.Message)
+
+	resp := r.AddNames("USERNAME").Redact(&testpb.SimpleResponse{Username: "alice", Hostname: "host"}).(*testpb.SimpleResponse)
+	assert.Equal(t, RedactedValue, resp.Username)
+	assert.Equal(t, "host", resp.Hostname)
+
+	assert.Nil(t, r.Redact(nil))
+}
+
+func TestRedactorRepeatedAndMaps(t *testing.T) {
+	req := &testpb.StreamingOutputCallRequest{
+		ResponseParameters: []*testpb.ResponseParameters{{Size: 1, IntervalUs: 5}, {Size: 2, IntervalUs: 6}},
+	}
+	redacted := NewRedactor().AddPaths("response_parameters.size").Redact(req).(*testpb.StreamingOutputCallRequest)
+	for _, params := range redacted.ResponseParameters {
+		assert.Equal(t, int32(0), params.Size)
+		assert.NotEqual(t, int32(0), params.IntervalUs)
+	}
+
+	s, _ := structpb.NewStruct(map[string]any{"name": "alice", "age": 30})
+	redactedStruct := NewRedactor().AddPaths("fields.string_value").Redact(s).(*structpb.Struct)
+	assert.Equal(t, RedactedValue, redactedStruct.Fields["name"].GetStringValue())
+	assert.Equal(t, float64(30), redactedStruct.Fields["age"].GetNumberValue())
+
+	// Selecting a map of messages clears it
+	labels := &structpb.Struct{Fields: map[string]*structpb.Value{"a": structpb.NewStringValue("x")}}
+	redactedLabels := NewRedactor().AddNames("fields").Redact(labels).(*structpb.Struct)
+	assert.Empty(t, redactedLabels.Fields)
+}
+
+func TestRedactorOutput(t *testing.T) {
+	r := NewRedactor().AddNames("username")
+	resp := &testpb.SimpleResponse{Username: "alice"}
+
+	data, err := r.RedactJSON(resp)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), RedactedValue)
+	assert.NotContains(t, string(data), "alice")
+	_, err = r.RedactJSON(nil)
+	assert.NotNil(t, err)
+
+	assert.NotContains(t, r.Format(resp), "alice")
+	assert.Equal(t, "not a message", r.RedactPayload("not a message"))
+	assert.True(t, proto.Equal(&testpb.SimpleResponse{Username: RedactedValue}, r.RedactPayload(resp).(proto.Message)))
+}
+
+func TestDefaultRedactor(t *testing.T) {
+	RegisterSensitiveFields("fill_oauth_scope")
+	req := &testpb.SimpleRequest{FillOauthScope: true, FillUsername: true}
+
+	config := newErrorLoggerConfig([]ErrorLoggerOption{WithRequestPayloads(nil)})
+	redacted := config.payload(req).(*testpb.SimpleRequest)
+	assert.False(t, redacted.FillOauthScope)
+	assert.True(t, redacted.FillUsername)
+}
+
+func TestRequestLoggerRedactsPayloads(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	svc := &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		return &testpb.SimpleResponse{Username: "alice"}, nil
+	}}
+	config := RequestLoggerConfig{
+		Logger:      logger,
+		LogPayloads: true,
+		Redact:      NewRedactor().AddNames("username").RedactPayload,
+	}
+	conn := startTestServer(t, svc, []grpc.ServerOption{grpc.UnaryInterceptor(RequestLogger(config))})
+	_, err := testpb.NewTestServiceClient(conn).UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(logs.String(), RedactedValue))
+	assert.NotContains(t, logs.String(), "alice")
+}
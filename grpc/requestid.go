@@ -0,0 +1,146 @@
+package grpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"unicode"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata key carrying the request id, both in requests and response headers
+const RequestIdHeader = "x-request-id"
+
+// Longest request id accepted from clients.  Longer (or non printable) ids
+// are replaced with a new one.
+const maxRequestIdLength = 128
+
+type requestIdKey struct{}
+
+// ContextWithRequestId returns a context carrying the request id.
+func ContextWithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// RequestIdFromContext returns the request id injected by RequestIdInterceptor.
+func RequestIdFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIdKey{}).(string)
+	return id, ok
+}
+
+// NewRequestId returns a random 16 byte hex encoded id.
+func NewRequestId() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// RequestIdInterceptor takes the request id from the "x-request-id" metadata
+// (or assigns a new one with generate, NewRequestId if nil), stores it in the
+// context and echoes it in the response headers.  Install it before
+// ErrorLogger and RequestLogger so that their log lines (and the errors
+// ErrorLogger returns) carry the id.
+func RequestIdInterceptor(generate func() string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+		id := incomingRequestId(ctx, generate)
+		grpc.SetHeader(ctx, metadata.Pairs(RequestIdHeader, id))
+		return handler(ContextWithRequestId(ctx, id), req)
+	}
+}
+
+// StreamRequestIdInterceptor is the streaming counterpart of RequestIdInterceptor.
+func StreamRequestIdInterceptor(generate func() string) grpc.StreamServerInterceptor {
+	return func(srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		id := incomingRequestId(ss.Context(), generate)
+		ss.SetHeader(metadata.Pairs(RequestIdHeader, id))
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: ContextWithRequestId(ss.Context(), id)})
+	}
+}
+
+// RequestIdClientInterceptor propagates the request id in the context (eg of
+// the call being handled) to outgoing calls.
+func RequestIdClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoingRequestId(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamRequestIdClientInterceptor is the streaming counterpart of
+// RequestIdClientInterceptor.
+func StreamRequestIdClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+		method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoingRequestId(ctx), desc, cc, method, opts...)
+	}
+}
+
+func incomingRequestId(ctx context.Context, generate func() string) string {
+	if values := metadata.ValueFromIncomingContext(ctx, RequestIdHeader); len(values) > 0 && validRequestId(values[0]) {
+		return values[0]
+	}
+	if generate == nil {
+		return NewRequestId()
+	}
+	return generate()
+}
+
+func outgoingRequestId(ctx context.Context) context.Context {
+	id, ok := RequestIdFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(RequestIdHeader)) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, RequestIdHeader, id)
+}
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLength {
+		return false
+	}
+	for _, r := range id {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// withRequestInfo attaches the context's request id to a status error as a
+// RequestInfo detail (unless it already has one).
+func withRequestInfo(ctx context.Context, err error) error {
+	id, ok := RequestIdFromContext(ctx)
+	if !ok || err == nil {
+		return err
+	}
+	if _, found := ErrorDetail[*errdetails.RequestInfo](err); found {
+		return err
+	}
+	withInfo, detailErr := status.Convert(err).WithDetails(&errdetails.RequestInfo{RequestId: id})
+	if detailErr != nil {
+		return err
+	}
+	return withInfo.Err()
+}
+
+// RequestIdFromError returns the request id attached to an error returned by
+// ErrorLogger, eg for clients to quote when reporting problems.
+func RequestIdFromError(err error) (string, bool) {
+	info, found := ErrorDetail[*errdetails.RequestInfo](err)
+	if !found {
+		return "", false
+	}
+	return info.RequestId, true
+}
@@ -0,0 +1,105 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRequestIdInterceptor(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	svc := &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		id, _ := RequestIdFromContext(ctx)
+		switch req.ResponseSize {
+		case 1:
+			panic("boom")
+		case 2:
+			return nil, status.Error(codes.Internal, "broken")
+		}
+		return &testpb.SimpleResponse{Username: id}, nil
+	}}
+	conn := startTestServer(t, svc, []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(RequestIdInterceptor(nil), ErrorLogger(WithLogger(logger), WithStackTrace(false))),
+	})
+	client := testpb.NewTestServiceClient(conn)
+
+	// Ids sent by the client are used and echoed
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), RequestIdHeader, "req-123")
+	resp, err := client.UnaryCall(ctx, &testpb.SimpleRequest{}, grpc.Header(&header))
+	assert.Nil(t, err)
+	assert.Equal(t, "req-123", resp.Username)
+	assert.Equal(t, []string{"req-123"}, header.Get(RequestIdHeader))
+
+	// Otherwise a new one is assigned
+	resp, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{}, grpc.Header(&header))
+	assert.Nil(t, err)
+	assert.Equal(t, 32, len(resp.Username))
+	assert.Equal(t, []string{resp.Username}, header.Get(RequestIdHeader))
+
+	// Invalid ids are replaced
+	ctx = metadata.AppendToOutgoingContext(context.Background(), RequestIdHeader, strings.Repeat("x", 200))
+	resp, _ = client.UnaryCall(ctx, &testpb.SimpleRequest{})
+	assert.Equal(t, 32, len(resp.Username))
+
+	// Panics and errors are logged and returned with the id
+	ctx = metadata.AppendToOutgoingContext(context.Background(), RequestIdHeader, "req-panic")
+	_, err = client.UnaryCall(ctx, &testpb.SimpleRequest{ResponseSize: 1})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	id, ok := RequestIdFromError(err)
+	assert.True(t, ok)
+	assert.Equal(t, "req-panic", id)
+	assert.Contains(t, logs.String(), "request_id=req-panic")
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), RequestIdHeader, "req-error")
+	_, err = client.UnaryCall(ctx, &testpb.SimpleRequest{ResponseSize: 2})
+	id, _ = RequestIdFromError(err)
+	assert.Equal(t, "req-error", id)
+	assert.Contains(t, logs.String(), "request_id=req-error")
+
+	_, ok = RequestIdFromError(status.Error(codes.Internal, "no id"))
+	assert.False(t, ok)
+}
+
+func TestStreamRequestIdInterceptor(t *testing.T) {
+	svc := &testService{streamOut: func(req *testpb.StreamingOutputCallRequest, stream testpb.TestService_StreamingOutputCallServer) error {
+		id, _ := RequestIdFromContext(stream.Context())
+		return status.Error(codes.Internal, id)
+	}}
+	conn := startTestServer(t, svc, []grpc.ServerOption{
+		grpc.ChainStreamInterceptor(StreamRequestIdInterceptor(func() string { return "generated" }), StreamErrorLogger(WithLogger(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))))),
+	})
+	stream, err := testpb.NewTestServiceClient(conn).StreamingOutputCall(context.Background(), &testpb.StreamingOutputCallRequest{})
+	assert.Nil(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, "generated", status.Convert(err).Message())
+	id, _ := RequestIdFromError(err)
+	assert.Equal(t, "generated", id)
+	header, _ := stream.Header()
+	assert.Equal(t, []string{"generated"}, header.Get(RequestIdHeader))
+}
+
+func TestRequestIdClientInterceptor(t *testing.T) {
+	svc := &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		return &testpb.SimpleResponse{Username: strings.Join(md.Get(RequestIdHeader), ",")}, nil
+	}}
+	conn := startTestServer(t, svc, nil, grpc.WithUnaryInterceptor(RequestIdClientInterceptor()))
+	client := testpb.NewTestServiceClient(conn)
+
+	resp, _ := client.UnaryCall(ContextWithRequestId(context.Background(), "upstream"), &testpb.SimpleRequest{})
+	assert.Equal(t, "upstream", resp.Username)
+
+	resp, _ = client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Equal(t, "", resp.Username)
+}
@@ -0,0 +1,197 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// RequestLoggerConfig controls what RequestLogger and StreamRequestLogger log.
+type RequestLoggerConfig struct {
+	// Logger records are written to.  Defaults to slog.Default()
+	Logger *slog.Logger
+
+	// Incoming metadata keys to include in each record
+	MetadataKeys []string
+
+	// When set (and the logger has debug enabled), requests and responses of
+	// unary RPCs are dumped as JSON via DefaultProtoFormat.
+	LogPayloads bool
+
+	// Function applied to requests/responses before they are dumped.
+	// Defaults to DefaultRedactor.RedactPayload
+	Redact func(msg any) any
+
+	// Decides whether a successful RPC is logged.  Failed RPCs are always
+	// logged.  Defaults to logging everything.  See SampleRates.
+	Sampler func(method string) bool
+}
+
+// SampleRates returns a Sampler that logs a fraction (between 0 and 1) of
+// requests per method.  Methods not in rates are logged at defaultRate.
+func SampleRates(rates map[string]float64, defaultRate float64) func(method string) bool {
+	return func(method string) bool {
+		rate, ok := rates[method]
+		if !ok {
+			rate = defaultRate
+		}
+		return rate >= 1 || (rate > 0 && rand.Float64() < rate)
+	}
+}
+
+// RequestLogger emits one structured record per unary RPC with the method,
+// peer, duration, status code and request/response sizes.
+func RequestLogger(config RequestLoggerConfig) grpc.UnaryServerInterceptor {
+	config.setDefaults()
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+
+		start := time.Now()
+		resp, err = handler(ctx, req)
+		code := status.Code(err)
+		if code == codes.OK && !config.Sampler(info.FullMethod) {
+			return
+		}
+
+		attrs := config.commonAttrs(ctx, info.FullMethod, start, err)
+		attrs = append(attrs, slog.Int("request_size", messageSize(req)), slog.Int("response_size", messageSize(resp)))
+		if config.LogPayloads && config.Logger.Enabled(ctx, slog.LevelDebug) {
+			attrs = append(attrs, slog.String("request", config.dump(req)), slog.String("response", config.dump(resp)))
+		}
+		config.Logger.LogAttrs(ctx, levelForCode(code), "grpc request", attrs...)
+		return
+	}
+}
+
+// StreamRequestLogger emits one structured record per streaming RPC once the
+// stream completes, with message counts and total sizes in each direction.
+func StreamRequestLogger(config RequestLoggerConfig) grpc.StreamServerInterceptor {
+	config.setDefaults()
+	return func(srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+
+		start := time.Now()
+		counted := &countingServerStream{ServerStream: ss}
+		err = handler(srv, counted)
+		code := status.Code(err)
+		if code == codes.OK && !config.Sampler(info.FullMethod) {
+			return
+		}
+
+		attrs := config.commonAttrs(ss.Context(), info.FullMethod, start, err)
+		attrs = append(attrs,
+			slog.Int("messages_received", counted.received),
+			slog.Int("messages_sent", counted.sent),
+			slog.Int("request_size", counted.receivedBytes),
+			slog.Int("response_size", counted.sentBytes))
+		config.Logger.LogAttrs(ss.Context(), levelForCode(code), "grpc stream", attrs...)
+		return
+	}
+}
+
+func (c *RequestLoggerConfig) setDefaults() {
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	if c.Sampler == nil {
+		c.Sampler = func(string) bool { return true }
+	}
+	if c.Redact == nil {
+		c.Redact = DefaultRedactor.RedactPayload
+	}
+}
+
+func (c *RequestLoggerConfig) commonAttrs(ctx context.Context, method string, start time.Time, err error) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.Duration("duration", time.Since(start)),
+		slog.String("code", status.Code(err).String()),
+	}
+	if id, ok := RequestIdFromContext(ctx); ok {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		attrs = append(attrs, slog.String("peer", p.Addr.String()))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(c.MetadataKeys) > 0 {
+		var mdAttrs []any
+		for _, key := range c.MetadataKeys {
+			if values := md.Get(key); len(values) > 0 {
+				mdAttrs = append(mdAttrs, slog.String(key, strings.Join(values, ",")))
+			}
+		}
+		if len(mdAttrs) > 0 {
+			attrs = append(attrs, slog.Group("metadata", mdAttrs...))
+		}
+	}
+	return attrs
+}
+
+func (c *RequestLoggerConfig) dump(msg any) string {
+	if msg == nil {
+		return ""
+	}
+	return formatPayload(c.Redact(msg))
+}
+
+// levelForCode logs server side failures as errors, client side failures as
+// warnings and everything else as info.
+func levelForCode(code codes.Code) slog.Level {
+	switch code {
+	case codes.OK:
+		return slog.LevelInfo
+	case codes.Unknown, codes.Internal, codes.DataLoss, codes.Unimplemented, codes.Unavailable, codes.DeadlineExceeded:
+		return slog.LevelError
+	default:
+		return slog.LevelWarn
+	}
+}
+
+func messageSize(msg any) int {
+	if m, ok := msg.(protoreflect.ProtoMessage); ok && m != nil {
+		return proto.Size(m)
+	}
+	return 0
+}
+
+// countingServerStream tracks the number and size of messages on a stream.
+type countingServerStream struct {
+	grpc.ServerStream
+	sent, received           int
+	sentBytes, receivedBytes int
+}
+
+func (s *countingServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent++
+		s.sentBytes += messageSize(m)
+	}
+	return err
+}
+
+func (s *countingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received++
+		s.receivedBytes += messageSize(m)
+	}
+	return err
+}
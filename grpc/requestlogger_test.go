@@ -0,0 +1,89 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func parseLogRecords(t *testing.T, buf *bytes.Buffer) (records []map[string]any) {
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		assert.Nil(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return
+}
+
+func TestRequestLogger(t *testing.T) {
+	var logs bytes.Buffer
+	config := RequestLoggerConfig{
+		Logger:       slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		MetadataKeys: []string{"x-user"},
+		LogPayloads:  true,
+		Sampler: SampleRates(map[string]float64{
+			"/grpc.testing.TestService/StreamingOutputCall": 0,
+		}, 1),
+	}
+	svc := &testService{}
+	conn := startTestServer(t, svc, []grpc.ServerOption{
+		grpc.UnaryInterceptor(RequestLogger(config)),
+		grpc.StreamInterceptor(StreamRequestLogger(config)),
+	})
+	client := testpb.NewTestServiceClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-user", "alice")
+	_, err := client.UnaryCall(ctx, &testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte("hello")}})
+	assert.Nil(t, err)
+
+	// Sampled out
+	stream, err := client.StreamingOutputCall(ctx, &testpb.StreamingOutputCallRequest{
+		ResponseParameters: []*testpb.ResponseParameters{{}, {}},
+	})
+	assert.Nil(t, err)
+	for err == nil {
+		_, err = stream.Recv()
+	}
+
+	// Errors are always logged
+	svc.streamOut = func(req *testpb.StreamingOutputCallRequest, stream testpb.TestService_StreamingOutputCallServer) error {
+		stream.Send(&testpb.StreamingOutputCallResponse{})
+		return status.Error(codes.PermissionDenied, "denied")
+	}
+	stream, err = client.StreamingOutputCall(ctx, &testpb.StreamingOutputCallRequest{})
+	assert.Nil(t, err)
+	for err == nil {
+		_, err = stream.Recv()
+	}
+
+	records := parseLogRecords(t, &logs)
+	assert.Equal(t, 2, len(records))
+
+	unary := records[0]
+	assert.Equal(t, "INFO", unary["level"])
+	assert.Equal(t, "/grpc.testing.TestService/UnaryCall", unary["method"])
+	assert.Equal(t, "OK", unary["code"])
+	assert.Equal(t, "alice", unary["metadata"].(map[string]any)["x-user"])
+	assert.Greater(t, unary["request_size"], 0.0)
+	assert.Contains(t, unary["request"], "payload")
+	assert.NotEmpty(t, unary["peer"])
+
+	streamed := records[1]
+	assert.Equal(t, "WARN", streamed["level"])
+	assert.Equal(t, "PermissionDenied", streamed["code"])
+	assert.Equal(t, 1.0, streamed["messages_received"])
+	assert.Equal(t, 1.0, streamed["messages_sent"])
+}
@@ -0,0 +1,196 @@
+package grpc
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Outgoing metadata key carrying the (1 based) attempt number of a call
+const RetryAttemptHeader = "x-retry-attempt"
+
+// RetryConfig controls which calls RetryInterceptor retries and how often.
+type RetryConfig struct {
+	// Maximum number of attempts including the first one.  Defaults to 3
+	MaxAttempts int
+
+	// Status codes that are retried.  Defaults to Unavailable,
+	// ResourceExhausted and DeadlineExceeded.
+	RetryableCodes []codes.Code
+
+	// Backoff before the first retry.  Defaults to 50ms
+	InitialBackoff time.Duration
+
+	// Upper bound on the backoff between attempts.  Defaults to 5s
+	MaxBackoff time.Duration
+
+	// Factor the backoff grows by after each attempt.  Defaults to 2
+	Multiplier float64
+
+	// Fraction (0 to 1) of the backoff that is randomized.  Defaults to 0.2;
+	// a negative value disables jitter
+	Jitter float64
+
+	// Optional timeout applied to each attempt (bounded by the call's own
+	// deadline).  Without it a DeadlineExceeded attempt can only be retried
+	// if the server imposed the deadline.
+	PerAttemptTimeout time.Duration
+
+	// Decides if a method is idempotent and so safe to retry (see
+	// IdempotentMethods).  Calls are not retried without it.
+	Idempotent func(method string) bool
+
+	// Optional budget shared across calls limiting how many retries are made
+	// when a server is persistently failing.
+	Budget *RetryBudget
+}
+
+// RetryBudget throttles retries once too many calls are failing.  Each failed
+// attempt costs a token and each success earns back TokenRatio tokens.
+// Retries are only made while more than half the tokens are available.
+type RetryBudget struct {
+	mu         sync.Mutex
+	maxTokens  float64
+	tokenRatio float64
+	tokens     float64
+}
+
+func NewRetryBudget(maxTokens float64, tokenRatio float64) *RetryBudget {
+	return &RetryBudget{maxTokens: maxTokens, tokenRatio: tokenRatio, tokens: maxTokens}
+}
+
+// Tokens returns the number of tokens currently available.
+func (b *RetryBudget) Tokens() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens
+}
+
+func (b *RetryBudget) onSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.maxTokens, b.tokens+b.tokenRatio)
+}
+
+// onFailure records a failed attempt and returns whether a retry is allowed.
+func (b *RetryBudget) onFailure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Max(0, b.tokens-1)
+	return b.tokens > b.maxTokens/2
+}
+
+// IdempotentMethods returns a RetryConfig.Idempotent predicate accepting the
+// given full method names (eg "/pkg.Service/GetItem").
+func IdempotentMethods(methods ...string) func(method string) bool {
+	idempotent := make(map[string]bool)
+	for _, method := range methods {
+		idempotent[method] = true
+	}
+	return func(method string) bool {
+		return idempotent[method]
+	}
+}
+
+func (c *RetryConfig) setDefaults() {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 3
+	}
+	if c.RetryableCodes == nil {
+		c.RetryableCodes = []codes.Code{codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded}
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = 50 * time.Millisecond
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 5 * time.Second
+	}
+	if c.Multiplier <= 0 {
+		c.Multiplier = 2
+	}
+	if c.Jitter == 0 {
+		c.Jitter = 0.2
+	}
+	c.Jitter = math.Max(0, math.Min(1, c.Jitter))
+}
+
+// RetryInterceptor retries failed calls to idempotent methods (as decided by
+// config.Idempotent) with exponential backoff and jitter.  Calls are never
+// retried beyond their context's deadline.
+func RetryInterceptor(config RetryConfig) grpc.UnaryClientInterceptor {
+	config.setDefaults()
+	retryable := make(map[codes.Code]bool)
+	for _, code := range config.RetryableCodes {
+		retryable[code] = true
+	}
+
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		if config.Idempotent == nil || !config.Idempotent(method) {
+			return config.invokeAttempt(ctx, 1, method, req, reply, cc, invoker, opts...)
+		}
+
+		backoff := config.InitialBackoff
+		for attempt := 1; ; attempt++ {
+			err = config.invokeAttempt(ctx, attempt, method, req, reply, cc, invoker, opts...)
+			if err == nil {
+				if config.Budget != nil {
+					config.Budget.onSuccess()
+				}
+				return nil
+			}
+			if !retryable[status.Code(err)] || attempt >= config.MaxAttempts || ctx.Err() != nil {
+				return err
+			}
+			if config.Budget != nil && !config.Budget.onFailure() {
+				return err
+			}
+
+			// Servers can ask for a longer wait (eg when rate limiting)
+			wait := config.jittered(backoff)
+			if delay, ok := RetryDelay(err); ok && delay > wait {
+				wait = delay
+			}
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+				// No point waiting if the call would time out before the retry
+				return err
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+			backoff = time.Duration(math.Min(float64(config.MaxBackoff), float64(backoff)*config.Multiplier))
+		}
+	}
+}
+
+func (c *RetryConfig) invokeAttempt(ctx context.Context, attempt int, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, RetryAttemptHeader, strconv.Itoa(attempt))
+	if c.PerAttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.PerAttemptTimeout)
+		defer cancel()
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func (c *RetryConfig) jittered(backoff time.Duration) time.Duration {
+	if c.Jitter == 0 {
+		return backoff
+	}
+	// Spread uniformly over [backoff * (1 - jitter), backoff * (1 + jitter)]
+	delta := c.Jitter * float64(backoff)
+	return time.Duration(float64(backoff) - delta + rand.Float64()*2*delta)
+}
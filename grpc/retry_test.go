@@ -0,0 +1,127 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// flakyService fails the first N unary calls with the given code
+func flakyService(failures int, code codes.Code) (*testService, func() []string) {
+	var mu sync.Mutex
+	var attempts []string
+	svc := &testService{
+		unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			attempts = append(attempts, md.Get(RetryAttemptHeader)...)
+			if len(attempts) <= failures {
+				return nil, status.Error(code, "failing")
+			}
+			return &testpb.SimpleResponse{}, nil
+		},
+	}
+	return svc, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts
+	}
+}
+
+const unaryCallMethod = "/grpc.testing.TestService/UnaryCall"
+
+func newRetryClient(t *testing.T, svc *testService, config RetryConfig) testpb.TestServiceClient {
+	if config.Idempotent == nil {
+		config.Idempotent = IdempotentMethods(unaryCallMethod)
+	}
+	conn := startTestServer(t, svc, nil, grpc.WithUnaryInterceptor(RetryInterceptor(config)))
+	return testpb.NewTestServiceClient(conn)
+}
+
+func TestRetrySucceedsAfterFailures(t *testing.T) {
+	svc, attempts := flakyService(2, codes.Unavailable)
+	client := newRetryClient(t, svc, RetryConfig{InitialBackoff: time.Millisecond, Jitter: 0.5})
+	_, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, attempts())
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	svc, attempts := flakyService(5, codes.Unavailable)
+	client := newRetryClient(t, svc, RetryConfig{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+	_, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 2, len(attempts()))
+
+	// Non retryable codes fail straight away
+	svc, attempts = flakyService(5, codes.InvalidArgument)
+	client = newRetryClient(t, svc, RetryConfig{InitialBackoff: time.Millisecond})
+	_, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, 1, len(attempts()))
+
+	// As do non idempotent methods
+	svc, attempts = flakyService(5, codes.Unavailable)
+	client = newRetryClient(t, svc, RetryConfig{
+		InitialBackoff: time.Millisecond,
+		Idempotent:     func(method string) bool { return false },
+	})
+	_, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 1, len(attempts()))
+
+	// Nothing is retried unless methods are marked idempotent
+	svc, attempts = flakyService(5, codes.Unavailable)
+	conn := startTestServer(t, svc, nil, grpc.WithUnaryInterceptor(RetryInterceptor(RetryConfig{InitialBackoff: time.Millisecond})))
+	_, err = testpb.NewTestServiceClient(conn).UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 1, len(attempts()))
+}
+
+func TestRetryJitterDefaults(t *testing.T) {
+	config := RetryConfig{}
+	config.setDefaults()
+	assert.Equal(t, 0.2, config.Jitter)
+	wait := config.jittered(100 * time.Millisecond)
+	assert.True(t, wait >= 80*time.Millisecond && wait <= 120*time.Millisecond)
+
+	config = RetryConfig{Jitter: -1}
+	config.setDefaults()
+	assert.Equal(t, 100*time.Millisecond, config.jittered(100*time.Millisecond))
+}
+
+func TestRetryHonorsDeadline(t *testing.T) {
+	svc, attempts := flakyService(5, codes.Unavailable)
+	client := newRetryClient(t, svc, RetryConfig{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.UnaryCall(ctx, &testpb.SimpleRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 1, len(attempts()))
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := NewRetryBudget(4, 0.5)
+	svc, attempts := flakyService(100, codes.Unavailable)
+	client := newRetryClient(t, svc, RetryConfig{MaxAttempts: 5, InitialBackoff: time.Millisecond, Budget: budget})
+
+	// 4 tokens - retries stop once 2 or fewer remain
+	_, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, len(attempts()))
+	_, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, len(attempts()))
+	assert.Equal(t, 1.0, budget.Tokens())
+}
@@ -0,0 +1,246 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// FieldRule declares the constraints on a single field.  String and numeric
+// constraints of repeated fields apply to each element.  Unset fields (or
+// fields with the zero value if they have no presence) are only checked by
+// Required and MinItems.
+type FieldRule struct {
+	Required bool
+
+	// Length limits of strings (in characters) and bytes.  Zero MaxLen means
+	// no limit
+	MinLen int
+	MaxLen int
+
+	// Pattern strings must match
+	Pattern *regexp.Regexp
+
+	// Inclusive limits on numeric (and enum) values.  Nil means no limit
+	Min *float64
+	Max *float64
+
+	// Size limits of repeated and map fields.  Zero MaxItems means no limit
+	MinItems int
+	MaxItems int
+}
+
+// Bound returns a pointer to v for FieldRule.Min and FieldRule.Max.
+func Bound(v float64) *float64 {
+	return &v
+}
+
+// Validator validates messages against rules registered per message type
+// (keyed by full name).  Nested messages are validated with their own rules.
+type Validator struct {
+	mu    sync.RWMutex
+	rules map[protoreflect.FullName]map[protoreflect.Name]FieldRule
+}
+
+func NewValidator() *Validator {
+	return &Validator{rules: make(map[protoreflect.FullName]map[protoreflect.Name]FieldRule)}
+}
+
+// AddRules registers rules for fields (by proto name) of msg's type, replacing
+// earlier rules for the same fields.  Fails if a field does not exist.
+func (v *Validator) AddRules(msg proto.Message, rules map[string]FieldRule) error {
+	desc := msg.ProtoReflect().Descriptor()
+	for name := range rules {
+		if desc.Fields().ByName(protoreflect.Name(name)) == nil {
+			return fmt.Errorf("%s has no field named %s", desc.FullName(), name)
+		}
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	msgRules := v.rules[desc.FullName()]
+	if msgRules == nil {
+		msgRules = make(map[protoreflect.Name]FieldRule)
+		v.rules[desc.FullName()] = msgRules
+	}
+	for name, rule := range rules {
+		msgRules[protoreflect.Name(name)] = rule
+	}
+	return nil
+}
+
+// Validate checks msg against the registered rules and returns an
+// InvalidArgument error with a field violation for each broken rule.
+func (v *Validator) Validate(msg proto.Message) error {
+	var violations []*errdetails.BadRequest_FieldViolation
+	v.mu.RLock()
+	v.validateMessage(msg.ProtoReflect(), "", &violations)
+	v.mu.RUnlock()
+	if len(violations) > 0 {
+		return NewBadRequestError(fmt.Sprintf("invalid %s", msg.ProtoReflect().Descriptor().FullName()), violations...)
+	}
+	return nil
+}
+
+func (v *Validator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if msg, ok := req.(proto.Message); ok {
+			if err := v.Validate(msg); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor validates every message received on a stream.
+func (v *Validator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		return handler(srv, &validatingServerStream{ServerStream: ss, validator: v})
+	}
+}
+
+type validatingServerStream struct {
+	grpc.ServerStream
+	validator *Validator
+}
+
+func (s *validatingServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if msg, ok := m.(proto.Message); ok {
+		return s.validator.Validate(msg)
+	}
+	return nil
+}
+
+func (v *Validator) validateMessage(m protoreflect.Message, prefix string, violations *[]*errdetails.BadRequest_FieldViolation) {
+	rules := v.rules[m.Descriptor().FullName()]
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		path := prefix + string(fd.Name())
+		if rule, ok := rules[fd.Name()]; ok {
+			for _, problem := range rule.check(fd, m) {
+				*violations = append(*violations, NewFieldViolation(path, problem))
+			}
+		}
+		if fd.Message() == nil || !m.Has(fd) {
+			continue
+		}
+		// Validate nested messages with their own rules
+		switch {
+		case fd.IsList():
+			list := m.Get(fd).List()
+			for j := 0; j < list.Len(); j++ {
+				v.validateMessage(list.Get(j).Message(), fmt.Sprintf("%s[%d].", path, j), violations)
+			}
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				m.Get(fd).Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+					v.validateMessage(value.Message(), fmt.Sprintf("%s[%s].", path, formatMapKey(key)), violations)
+					return true
+				})
+			}
+		default:
+			v.validateMessage(m.Get(fd).Message(), path+".", violations)
+		}
+	}
+}
+
+// check returns a description of each way the field breaks the rule.
+func (r *FieldRule) check(fd protoreflect.FieldDescriptor, m protoreflect.Message) (problems []string) {
+	if !m.Has(fd) {
+		if r.Required {
+			problems = append(problems, "is required")
+		} else if fd.IsList() || fd.IsMap() {
+			problems = r.checkSize(0)
+		}
+		return
+	}
+	value := m.Get(fd)
+	switch {
+	case fd.IsList():
+		list := value.List()
+		problems = r.checkSize(list.Len())
+		for i := 0; i < list.Len(); i++ {
+			for _, problem := range r.checkValue(fd, list.Get(i)) {
+				problems = append(problems, fmt.Sprintf("item %d %s", i, problem))
+			}
+		}
+	case fd.IsMap():
+		problems = r.checkSize(value.Map().Len())
+	default:
+		problems = r.checkValue(fd, value)
+	}
+	return
+}
+
+func (r *FieldRule) checkSize(size int) (problems []string) {
+	if size < r.MinItems {
+		problems = append(problems, fmt.Sprintf("must have at least %d items", r.MinItems))
+	}
+	if r.MaxItems > 0 && size > r.MaxItems {
+		problems = append(problems, fmt.Sprintf("must have at most %d items", r.MaxItems))
+	}
+	return
+}
+
+func (r *FieldRule) checkValue(fd protoreflect.FieldDescriptor, value protoreflect.Value) (problems []string) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		s := value.String()
+		problems = r.checkLength(utf8.RuneCountInString(s), "characters")
+		if r.Pattern != nil && !r.Pattern.MatchString(s) {
+			problems = append(problems, fmt.Sprintf("must match %s", r.Pattern))
+		}
+	case protoreflect.BytesKind:
+		problems = r.checkLength(len(value.Bytes()), "bytes")
+	case protoreflect.BoolKind, protoreflect.MessageKind, protoreflect.GroupKind:
+	default:
+		n := numericValue(fd, value)
+		if r.Min != nil && n < *r.Min {
+			problems = append(problems, fmt.Sprintf("must be at least %v", *r.Min))
+		}
+		if r.Max != nil && n > *r.Max {
+			problems = append(problems, fmt.Sprintf("must be at most %v", *r.Max))
+		}
+	}
+	return
+}
+
+func (r *FieldRule) checkLength(length int, unit string) (problems []string) {
+	if length < r.MinLen {
+		problems = append(problems, fmt.Sprintf("must be at least %d %s", r.MinLen, unit))
+	}
+	if r.MaxLen > 0 && length > r.MaxLen {
+		problems = append(problems, fmt.Sprintf("must be at most %d %s", r.MaxLen, unit))
+	}
+	return
+}
+
+func numericValue(fd protoreflect.FieldDescriptor, value protoreflect.Value) float64 {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		return float64(value.Enum())
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return value.Float()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return float64(value.Uint())
+	default:
+		return float64(value.Int())
+	}
+}
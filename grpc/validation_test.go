@@ -0,0 +1,109 @@
+package grpc
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+)
+
+func testValidator(t *testing.T) *Validator {
+	v := NewValidator()
+	assert.Nil(t, v.AddRules(&testpb.SimpleRequest{}, map[string]FieldRule{
+		"payload":       {Required: true},
+		"response_size": {Min: Bound(1), Max: Bound(100)},
+	}))
+	assert.Nil(t, v.AddRules(&testpb.Payload{}, map[string]FieldRule{
+		"body": {MaxLen: 3},
+	}))
+	assert.Nil(t, v.AddRules(&testpb.StreamingOutputCallRequest{}, map[string]FieldRule{
+		"response_parameters": {MinItems: 1, MaxItems: 2},
+	}))
+	assert.Nil(t, v.AddRules(&testpb.ResponseParameters{}, map[string]FieldRule{
+		"size": {Max: Bound(10)},
+	}))
+	assert.Nil(t, v.AddRules(&testpb.SimpleResponse{}, map[string]FieldRule{
+		"username": {Required: true, MinLen: 2, Pattern: regexp.MustCompile("^[a-z]+$")},
+	}))
+	return v
+}
+
+func violationMap(err error) map[string]string {
+	out := make(map[string]string)
+	for _, violation := range FieldViolations(err) {
+		out[violation.Field] = violation.Description
+	}
+	return out
+}
+
+func TestValidatorValidate(t *testing.T) {
+	v := testValidator(t)
+	assert.Nil(t, v.Validate(&testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte("ok")}}))
+	assert.Nil(t, v.Validate(&testpb.SimpleRequest{Payload: &testpb.Payload{}, ResponseSize: 100}))
+
+	err := v.Validate(&testpb.SimpleRequest{ResponseSize: 101})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, map[string]string{
+		"payload":       "is required",
+		"response_size": "must be at most 100",
+	}, violationMap(err))
+
+	err = v.Validate(&testpb.SimpleRequest{ResponseSize: -1, Payload: &testpb.Payload{Body: []byte("long")}})
+	assert.Equal(t, map[string]string{
+		"response_size": "must be at least 1",
+		"payload.body":  "must be at most 3 bytes",
+	}, violationMap(err))
+
+	err = v.Validate(&testpb.StreamingOutputCallRequest{
+		ResponseParameters: []*testpb.ResponseParameters{{Size: 1}, {Size: 20}, {}},
+	})
+	assert.Equal(t, map[string]string{
+		"response_parameters":         "must have at most 2 items",
+		"response_parameters[1].size": "must be at most 10",
+	}, violationMap(err))
+	assert.Equal(t, map[string]string{"response_parameters": "must have at least 1 items"},
+		violationMap(v.Validate(&testpb.StreamingOutputCallRequest{})))
+
+	assert.Nil(t, v.Validate(&testpb.SimpleResponse{Username: "alice"}))
+	assert.Equal(t, 2, len(FieldViolations(v.Validate(&testpb.SimpleResponse{Username: "A"}))))
+
+	// Messages without rules are always valid
+	assert.Nil(t, v.Validate(&testpb.Empty{}))
+}
+
+func TestValidatorAddRulesUnknownField(t *testing.T) {
+	assert.NotNil(t, NewValidator().AddRules(&testpb.SimpleRequest{}, map[string]FieldRule{"missing": {Required: true}}))
+}
+
+func TestValidatorInterceptors(t *testing.T) {
+	v := testValidator(t)
+	called := false
+	svc := &testService{unary: func(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+		called = true
+		return &testpb.SimpleResponse{}, nil
+	}}
+	conn := startTestServer(t, svc, []grpc.ServerOption{
+		grpc.UnaryInterceptor(v.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(v.StreamServerInterceptor()),
+	})
+	client := testpb.NewTestServiceClient(conn)
+
+	_, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "is required", violationMap(err)["payload"])
+	assert.False(t, called)
+
+	_, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{Payload: &testpb.Payload{}})
+	assert.Nil(t, err)
+	assert.True(t, called)
+
+	stream, err := client.StreamingOutputCall(context.Background(), &testpb.StreamingOutputCallRequest{})
+	assert.Nil(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
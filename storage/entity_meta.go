@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Name of the sidecar file (in each entity dir) holding the EntityMeta
+const entityMetaFile = "_meta.json"
+
+// EntityMeta holds the bookkeeping fields FileStorage maintains for every
+// entity when created with WithEntityMeta.  Like dal.BaseEntity it tracks
+// creation and update times along with the creator and a revision that is
+// bumped on every change to the entity's artifacts.
+//
+// When an artifact being saved has fields named created_at, updated_at,
+// created_by or revision, they are also populated from the entity meta, both
+// in the saved JSON and in the message passed to SaveArtifact (so callers see
+// the new revision without reloading).
+// Time fields can be google.protobuf.Timestamp or RFC3339 strings and the
+// revision field can be any integer type.
+type EntityMeta struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	Revision  int64     `json:"revision"`
+}
+
+// WithEntityMeta enables maintaining an EntityMeta for each entity.
+func WithEntityMeta() FileStorageOption {
+	return func(f *FileStorage) {
+		f.trackMeta = true
+	}
+}
+
+// CreateEntityAs creates an entity like CreateEntity and records the creator
+// in its EntityMeta.  If entity meta is not enabled this is the same as
+// CreateEntity.
+func (f *FileStorage) CreateEntityAs(customId string, createdBy string) (newId string, err error) {
+	if !f.trackMeta {
+		return f.CreateEntity(customId)
+	}
+
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	if newId, err = f.claimEntityDir(customId); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if err = f.writeEntityMeta(newId, &EntityMeta{CreatedAt: now, UpdatedAt: now, CreatedBy: createdBy}); err != nil {
+		return "", err
+	}
+	return newId, nil
+}
+
+// claimEntityDir creates the directory for a new entity (with a random id if
+// customId is empty).  Creating the directory is what claims the id so two
+// concurrent creates of the same id cannot both succeed.
+func (f *FileStorage) claimEntityDir(customId string) (string, error) {
+	const MaxRetries = 5
+	for range MaxRetries {
+		id := customId
+		if id == "" {
+			var err error
+			if id, err = NewRandomId(); err != nil {
+				return "", fmt.Errorf("failed to generate entity ID: %w", err)
+			}
+		}
+		err := os.Mkdir(f.getEntityDir(id), 0755)
+		if err == nil {
+			return id, nil
+		}
+		if !os.IsExist(err) {
+			return "", fmt.Errorf("failed to create entity directory for %s: %w", id, err)
+		}
+		if customId != "" {
+			return "", fmt.Errorf("ID '%s' already exists", customId)
+		}
+	}
+	// Kept colliding with existing ids
+	return "", fmt.Errorf("ID Generation failed")
+}
+
+// GetEntityMeta returns the EntityMeta for an entity.  Returns an error
+// satisfying os.IsNotExist if the entity has no meta (yet).
+func (f *FileStorage) GetEntityMeta(id string) (*EntityMeta, error) {
+	data, err := os.ReadFile(filepath.Join(f.getEntityDir(id), entityMetaFile))
+	if err != nil {
+		return nil, err
+	}
+	var meta EntityMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("invalid entity meta for entity %s: %w", id, err)
+	}
+	return &meta, nil
+}
+
+// nextEntityMeta returns the entity meta to be recorded for the next change
+// to an entity.  Must be called with writeMu held.
+func (f *FileStorage) nextEntityMeta(id string) (*EntityMeta, error) {
+	now := time.Now()
+	meta, err := f.GetEntityMeta(id)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		meta = &EntityMeta{CreatedAt: now}
+	}
+	meta.UpdatedAt = now
+	meta.Revision++
+	return meta, nil
+}
+
+// writeEntityMeta atomically writes the meta sidecar for an entity.  Must be
+// called with writeMu held.
+func (f *FileStorage) writeEntityMeta(id string, meta *EntityMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal entity meta for entity %s: %w", id, err)
+	}
+	metaPath := filepath.Join(f.getEntityDir(id), entityMetaFile)
+	tmpPath := metaPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write entity meta for entity %s: %w", id, err)
+	}
+	if err := os.Rename(tmpPath, metaPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename entity meta for entity %s: %w", id, err)
+	}
+	return nil
+}
+
+// stampEntityMeta populates the well known meta fields of a message (if it has
+// them).  If inPlace is false, the message is cloned before being modified.
+func stampEntityMeta(m proto.Message, meta *EntityMeta, inPlace bool) proto.Message {
+	if meta == nil || m == nil {
+		return m
+	}
+	fields := m.ProtoReflect().Descriptor().Fields()
+	if fields.ByName("created_at") == nil && fields.ByName("updated_at") == nil &&
+		fields.ByName("created_by") == nil && fields.ByName("revision") == nil {
+		return m
+	}
+	if !inPlace {
+		m = proto.Clone(m)
+	}
+	msg := m.ProtoReflect()
+	setTimeField(msg, "created_at", meta.CreatedAt)
+	setTimeField(msg, "updated_at", meta.UpdatedAt)
+	if fd := fields.ByName("created_by"); fd != nil && fd.Kind() == protoreflect.StringKind && !fd.IsList() && meta.CreatedBy != "" {
+		msg.Set(fd, protoreflect.ValueOfString(meta.CreatedBy))
+	}
+	if fd := fields.ByName("revision"); fd != nil && !fd.IsList() {
+		switch fd.Kind() {
+		case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+			msg.Set(fd, protoreflect.ValueOfInt64(meta.Revision))
+		case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+			msg.Set(fd, protoreflect.ValueOfInt32(int32(meta.Revision)))
+		case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+			msg.Set(fd, protoreflect.ValueOfUint64(uint64(meta.Revision)))
+		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+			msg.Set(fd, protoreflect.ValueOfUint32(uint32(meta.Revision)))
+		}
+	}
+	return m
+}
+
+func setTimeField(msg protoreflect.Message, name protoreflect.Name, t time.Time) {
+	fd := msg.Descriptor().Fields().ByName(name)
+	if fd == nil || fd.IsList() || fd.IsMap() {
+		return
+	}
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		msg.Set(fd, protoreflect.ValueOfString(t.UTC().Format(time.RFC3339Nano)))
+	case protoreflect.MessageKind:
+		if fd.Message().FullName() == "google.protobuf.Timestamp" {
+			ts := msg.NewField(fd).Message()
+			tspb := timestamppb.New(t)
+			ts.Set(ts.Descriptor().Fields().ByName("seconds"), protoreflect.ValueOfInt64(tspb.Seconds))
+			ts.Set(ts.Descriptor().Fields().ByName("nanos"), protoreflect.ValueOfInt32(tspb.Nanos))
+			msg.Set(fd, protoreflect.ValueOfMessage(ts))
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// newMetaTestMessage creates a dynamic message with the well known meta fields
+func newMetaTestMessage(t *testing.T) *dynamicpb.Message {
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(num),
+			Type:   typ.Enum(),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("metatest.proto"),
+		Package:    proto.String("metatest"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Doc"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("title", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("created_at", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+				field("updated_at", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("created_by", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("revision", 5, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+			},
+		}},
+	}
+	fd, err := protodesc.NewFile(fdp, protoRegistryWithTimestamp())
+	assert.Nil(t, err)
+	return dynamicpb.NewMessage(fd.Messages().ByName("Doc"))
+}
+
+func protoRegistryWithTimestamp() *protoregistry.Files {
+	files := &protoregistry.Files{}
+	files.RegisterFile(timestamppb.File_google_protobuf_timestamp_proto)
+	return files
+}
+
+func TestEntityMeta(t *testing.T) {
+	fs := NewFileStorage(t.TempDir(), WithEntityMeta())
+	id, err := fs.CreateEntityAs("e1", "alice")
+	assert.Nil(t, err)
+
+	meta, err := fs.GetEntityMeta(id)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", meta.CreatedBy)
+	assert.Equal(t, int64(0), meta.Revision)
+	created := meta.CreatedAt
+
+	time.Sleep(5 * time.Millisecond)
+	assert.Nil(t, fs.SaveArtifact(id, "notes", wrapperspb.String("hello")))
+	assert.Nil(t, fs.AtomicUpdate(id, "notes", func(m proto.Message) error {
+		m.(*wrapperspb.StringValue).Value = "world"
+		return nil
+	}, &wrapperspb.StringValue{}))
+
+	meta, err = fs.GetEntityMeta(id)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), meta.Revision)
+	assert.True(t, meta.CreatedAt.Equal(created))
+	assert.True(t, meta.UpdatedAt.After(created))
+
+	// Sidecar is not counted as an artifact
+	usage, err := fs.Usage(id)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, usage.ArtifactCount)
+
+	// Fields are injected into messages that have them
+	doc := newMetaTestMessage(t)
+	doc.Set(doc.Descriptor().Fields().ByName("title"), protoreflect.ValueOfString("hello"))
+	assert.Nil(t, fs.SaveArtifact(id, "metadata", doc))
+
+	loaded := dynamicpb.NewMessage(doc.Descriptor())
+	assert.Nil(t, fs.LoadArtifact(id, "metadata", loaded))
+	fields := loaded.Descriptor().Fields()
+	assert.Equal(t, int64(3), loaded.Get(fields.ByName("revision")).Int())
+	assert.Equal(t, "alice", loaded.Get(fields.ByName("created_by")).String())
+	assert.NotEmpty(t, loaded.Get(fields.ByName("updated_at")).String())
+	assert.True(t, loaded.Has(fields.ByName("created_at")))
+
+	// and the caller's message sees them too
+	assert.Equal(t, int64(3), doc.Get(fields.ByName("revision")).Int())
+}
+
+func TestCreateEntityAsConcurrent(t *testing.T) {
+	fs := NewFileStorage(t.TempDir(), WithEntityMeta())
+	creators := []string{"alice", "bob", "carol", "dave"}
+	winners := make(chan string, len(creators))
+	var wg sync.WaitGroup
+	for _, creator := range creators {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := fs.CreateEntityAs("shared", creator); err == nil {
+				winners <- creator
+			}
+		}()
+	}
+	wg.Wait()
+	close(winners)
+	assert.Equal(t, 1, len(winners))
+	meta, err := fs.GetEntityMeta("shared")
+	assert.Nil(t, err)
+	assert.Equal(t, <-winners, meta.CreatedBy)
+
+	// Generated ids are claimed the same way
+	id, err := fs.CreateEntityAs("", "erin")
+	assert.Nil(t, err)
+	exists, _ := fs.EntityExists(id)
+	assert.True(t, exists)
+}
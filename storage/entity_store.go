@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"log"
+	"os"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// EntityStore provides typed access to one named artifact (eg "metadata")
+// across all the entities in a FileStorage.
+type EntityStore[T proto.Message] struct {
+	Storage  *FileStorage
+	Artifact string
+}
+
+func NewEntityStore[T proto.Message](storage *FileStorage, artifact string) *EntityStore[T] {
+	return &EntityStore[T]{Storage: storage, Artifact: artifact}
+}
+
+// Get loads the artifact for an entity.  Returns an error satisfying
+// os.IsNotExist if the entity does not have this artifact.
+func (s *EntityStore[T]) Get(id string) (out T, err error) {
+	value := newProtoInstance[T]()
+	if err = s.Storage.LoadArtifact(id, s.Artifact, value); err != nil {
+		return
+	}
+	return value, nil
+}
+
+// Put atomically saves the artifact for an entity.
+func (s *EntityStore[T]) Put(id string, value T) error {
+	return s.Storage.AtomicSaveArtifact(id, s.Artifact, value)
+}
+
+// Update atomically loads, modifies and saves the artifact for an entity.  If
+// the artifact does not exist updateFn is passed an empty instance.  Nothing
+// is saved if updateFn returns an error.
+func (s *EntityStore[T]) Update(id string, updateFn func(T) error) (out T, err error) {
+	value := newProtoInstance[T]()
+	err = s.Storage.AtomicUpdate(id, s.Artifact, func(m proto.Message) error {
+		return updateFn(m.(T))
+	}, value)
+	if err != nil {
+		return
+	}
+	return value, nil
+}
+
+// Delete removes the artifact (but not the entity) for an entity.
+func (s *EntityStore[T]) Delete(id string) error {
+	return s.Storage.DeleteArtifact(id, s.Artifact)
+}
+
+// List loads the artifact from every entity that has it, optionally
+// filtering them with validate.  Results are keyed by entity id.
+func (s *EntityStore[T]) List(validate func(id string, value T) bool) (out map[string]T, err error) {
+	ids, err := s.Storage.ListEntityIds()
+	if err != nil {
+		return nil, err
+	}
+	out = make(map[string]T)
+	for _, id := range ids {
+		value, err := s.Get(id)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("Failed to load artifact (%s) for entity %s: %v", s.Artifact, id, err)
+			}
+			continue
+		}
+		if validate == nil || validate(id, value) {
+			out[id] = value
+		}
+	}
+	return
+}
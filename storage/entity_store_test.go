@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestEntityStore(t *testing.T) {
+	fs := NewFileStorage(t.TempDir())
+	store := NewEntityStore[*wrapperspb.StringValue](fs, "title")
+
+	_, err := store.Get("e1")
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, store.Put("e1", wrapperspb.String("hello")))
+	value, err := store.Get("e1")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", value.Value)
+
+	value, err = store.Update("e1", func(v *wrapperspb.StringValue) error {
+		v.Value += " world"
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", value.Value)
+
+	// Failed updates are not saved
+	_, err = store.Update("e1", func(v *wrapperspb.StringValue) error {
+		v.Value = "oops"
+		return errors.New("failed")
+	})
+	assert.NotNil(t, err)
+
+	// Updates create missing artifacts
+	_, err = store.Update("e2", func(v *wrapperspb.StringValue) error {
+		v.Value = "second"
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// Entities without the artifact are skipped
+	assert.Nil(t, fs.SaveArtifact("e3", "other", wrapperspb.String("ignored")))
+
+	all, err := store.List(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(all))
+	assert.Equal(t, "hello world", all["e1"].Value)
+	assert.Equal(t, "second", all["e2"].Value)
+
+	filtered, err := store.List(func(id string, v *wrapperspb.StringValue) bool { return id == "e2" })
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(filtered))
+
+	assert.Nil(t, store.Delete("e1"))
+	_, err = store.Get("e1")
+	assert.True(t, os.IsNotExist(err))
+}
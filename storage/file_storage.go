@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 
 	pj "google.golang.org/protobuf/encoding/protojson"
@@ -23,15 +24,47 @@ import (
 type FileStorage struct {
 	storageDir string
 	mu         sync.RWMutex // Add thread safety for coordination
+
+	// Serializes writes for quota accounting and entity meta updates
+	writeMu sync.Mutex
+
+	// Quota enforcement and the running total of bytes in the storage dir
+	quota        Quota
+	storageBytes int64
+	storageKnown bool
+
+	// Whether created/updated times and revisions are maintained per entity
+	trackMeta bool
+
+	// Optional full text index over artifact fields
+	index *searchIndex
+}
+
+// FileStorageOption customizes a FileStorage when it is created.
+type FileStorageOption func(f *FileStorage)
+
+var artifactMarshalOptions = pj.MarshalOptions{
+	Indent:            "  ",
+	UseProtoNames:     true,
+	EmitDefaultValues: true,
 }
 
-func NewFileStorage(storageDir string) *FileStorage {
+func NewFileStorage(storageDir string, opts ...FileStorageOption) *FileStorage {
 	// Ensure storage directory exists
 	if err := os.MkdirAll(storageDir, 0755); err != nil {
 		log.Printf("Failed to create storage directory: %v", err)
 		panic(err)
 	}
-	return &FileStorage{storageDir: storageDir}
+	f := &FileStorage{storageDir: storageDir}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// StorageDir returns the directory entities are stored in.
+func (f *FileStorage) StorageDir() string {
+	return f.storageDir
 }
 
 func (f *FileStorage) CreateEntity(customId string) (newId string, err error) {
@@ -77,33 +110,90 @@ func (f *FileStorage) EntityExists(id string) (exists bool, err error) {
 }
 
 func (f *FileStorage) DeleteEntity(id string) error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	usage, err := f.entityUsage(id)
+	if err != nil {
+		return err
+	}
+
 	entityPath := f.getEntityDir(id)
-	err := os.RemoveAll(entityPath)
+	err = os.RemoveAll(entityPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			err = nil
 		}
+		// Partial deletes leave the running total unknown - rescan later
+		f.storageKnown = false
+	} else {
+		f.recordUsage(-usage.TotalBytes)
+		if f.index != nil {
+			f.index.remove(id)
+		}
 	}
 	return err
 }
 
-func ListFSEntities[T proto.Message](f *FileStorage, validate func(entry T) bool) (entities []T, err error) {
-	// Read all entity directories
+// DeleteArtifact removes a single named artifact from an entity.  Deleting an
+// artifact that does not exist is not an error.
+func (f *FileStorage) DeleteArtifact(id string, name string) error {
+	if !validPathName(name) {
+		return invalidArtifactName(name)
+	}
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	artifactPath := f.getArtifactPath(id, name)
+	info, err := os.Stat(artifactPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := os.Remove(artifactPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete artifact %s for entity %s: %w", name, id, err)
+	}
+	f.recordUsage(-info.Size())
+	if f.index != nil && name == f.index.config.Artifact {
+		f.index.remove(id)
+	}
+	if f.trackMeta {
+		meta, err := f.nextEntityMeta(id)
+		if err != nil {
+			return err
+		}
+		return f.writeEntityMeta(id, meta)
+	}
+	return nil
+}
+
+// ListEntityIds returns the ids of all entities in the storage dir.
+func (f *FileStorage) ListEntityIds() (ids []string, err error) {
 	entries, err := os.ReadDir(f.storageDir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			// Storage directory doesn't exist yet, return empty list
 			return nil, nil
 		}
 		return nil, fmt.Errorf("failed to read storage directory: %w", err)
 	}
-
 	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+		if entry.IsDir() {
+			ids = append(ids, entry.Name())
 		}
+	}
+	return
+}
 
-		entityId := entry.Name()
+func ListFSEntities[T proto.Message](f *FileStorage, validate func(entry T) bool) (entities []T, err error) {
+	// Read all entity directories
+	ids, err := f.ListEntityIds()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entityId := range ids {
 		newInstance, err := LoadFSArtifact[T](f, entityId, "metadata")
 		if err != nil {
 			log.Printf("Failed to artifact for entity %s: %v", entityId, err)
@@ -138,65 +228,20 @@ func (f *FileStorage) LoadArtifact(id string, name string, m proto.Message) erro
 	return pj.Unmarshal(data, m)
 }
 
+// SaveArtifact marshals m as JSON into the named artifact of an entity.  With
+// WithEntityMeta, any created_at, updated_at, created_by and revision fields
+// of m are updated in place (after a successful write) to match what was
+// saved.
 func (f *FileStorage) SaveArtifact(id string, name string, m proto.Message) error {
-	entityDir := f.getEntityDir(id)
-	if err := os.MkdirAll(entityDir, 0755); err != nil {
-		return fmt.Errorf("failed to create entity directory %s: %w", entityDir, err)
-	}
-
-	mo := pj.MarshalOptions{
-		Indent:            "  ",
-		UseProtoNames:     true,
-		EmitDefaultValues: true,
-	}
-	data, err := mo.Marshal(m)
-	if err != nil {
-		return fmt.Errorf("failed to marshal metadata for entity %s: %w", id, err)
-	}
-
-	artifactPath := f.getArtifactPath(id, name)
-	if err := os.WriteFile(artifactPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write metadata for entity %s: %w", id, err)
-	}
-
-	return nil
+	return f.writeArtifact(id, name, m, false)
 }
 
-// AtomicSaveArtifact saves an artifact atomically (write to temp, then rename)
+// AtomicSaveArtifact saves an artifact atomically (write to temp, then rename).
+// Like SaveArtifact it stamps the entity meta fields of m in place.
 func (f *FileStorage) AtomicSaveArtifact(id string, name string, m proto.Message) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-
-	entityDir := f.getEntityDir(id)
-	if err := os.MkdirAll(entityDir, 0755); err != nil {
-		return fmt.Errorf("failed to create entity directory %s: %w", entityDir, err)
-	}
-
-	mo := pj.MarshalOptions{
-		Indent:            "  ",
-		UseProtoNames:     true,
-		EmitDefaultValues: true,
-	}
-	data, err := mo.Marshal(m)
-	if err != nil {
-		return fmt.Errorf("failed to marshal metadata for entity %s: %w", id, err)
-	}
-
-	artifactPath := f.getArtifactPath(id, name)
-	tmpPath := artifactPath + ".tmp"
-
-	// Write to temp file first
-	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write temp file for entity %s: %w", id, err)
-	}
-
-	// Atomic rename
-	if err := os.Rename(tmpPath, artifactPath); err != nil {
-		os.Remove(tmpPath) // Clean up temp file
-		return fmt.Errorf("failed to rename file for entity %s: %w", id, err)
-	}
-
-	return nil
+	return f.writeArtifact(id, name, m, true)
 }
 
 // AtomicUpdate performs an atomic read-modify-write operation
@@ -216,35 +261,72 @@ func (f *FileStorage) AtomicUpdate(id string, name string, updateFn func(proto.M
 	}
 
 	// Save atomically (we're already holding the lock)
-	entityDir := f.getEntityDir(id)
-	if err := os.MkdirAll(entityDir, 0755); err != nil {
-		return fmt.Errorf("failed to create entity directory %s: %w", entityDir, err)
-	}
+	return f.writeArtifact(id, name, msgType, true)
+}
 
-	mo := pj.MarshalOptions{
-		Indent:            "  ",
-		UseProtoNames:     true,
-		EmitDefaultValues: true,
+// writeArtifact marshals and writes an artifact after making sure the write
+// fits within the configured quota.  When atomic is set the data is written
+// to a temp file first and then renamed into place.
+func (f *FileStorage) writeArtifact(id string, name string, m proto.Message, atomic bool) error {
+	// Internal files (eg the entity meta) are not artifacts and must not be
+	// overwritten or escaped from
+	if !validPathName(name) {
+		return invalidArtifactName(name)
 	}
-	data, err := mo.Marshal(msgType)
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	var meta *EntityMeta
+	if f.trackMeta {
+		var err error
+		if meta, err = f.nextEntityMeta(id); err != nil {
+			return err
+		}
+	}
+
+	data, err := artifactMarshalOptions.Marshal(stampEntityMeta(m, meta, false))
 	if err != nil {
 		return fmt.Errorf("failed to marshal metadata for entity %s: %w", id, err)
 	}
 
-	artifactPath := f.getArtifactPath(id, name)
-	tmpPath := artifactPath + ".tmp"
+	delta, err := f.checkQuota(id, name, int64(len(data)))
+	if err != nil {
+		return err
+	}
 
-	// Write to temp file first
-	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write temp file for entity %s: %w", id, err)
+	entityDir := f.getEntityDir(id)
+	if err := os.MkdirAll(entityDir, 0755); err != nil {
+		return fmt.Errorf("failed to create entity directory %s: %w", entityDir, err)
 	}
 
-	// Atomic rename
-	if err := os.Rename(tmpPath, artifactPath); err != nil {
-		os.Remove(tmpPath) // Clean up temp file
-		return fmt.Errorf("failed to rename file for entity %s: %w", id, err)
+	artifactPath := f.getArtifactPath(id, name)
+	if !atomic {
+		if err := os.WriteFile(artifactPath, data, 0644); err != nil {
+			return fmt.Errorf("failed to write metadata for entity %s: %w", id, err)
+		}
+	} else {
+		tmpPath := artifactPath + ".tmp"
+
+		// Write to temp file first
+		if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+			return fmt.Errorf("failed to write temp file for entity %s: %w", id, err)
+		}
+
+		// Atomic rename
+		if err := os.Rename(tmpPath, artifactPath); err != nil {
+			os.Remove(tmpPath) // Clean up temp file
+			return fmt.Errorf("failed to rename file for entity %s: %w", id, err)
+		}
 	}
 
+	f.recordUsage(delta)
+	if f.index != nil && name == f.index.config.Artifact {
+		f.index.update(id, data)
+	}
+	if meta != nil {
+		stampEntityMeta(m, meta, true)
+		return f.writeEntityMeta(id, meta)
+	}
 	return nil
 }
 
@@ -263,6 +345,17 @@ func (f *FileStorage) ReadArtifactFile(id string, name string) ([]byte, error) {
 
 // Utility functions
 
+// validPathName rejects ids/names that could escape the storage dir or
+// clash with internal files.
+func validPathName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\`) &&
+		!strings.HasPrefix(name, ".") && !strings.HasPrefix(name, "_")
+}
+
+func invalidArtifactName(name string) error {
+	return fmt.Errorf("invalid artifact name %q: %w", name, os.ErrInvalid)
+}
+
 // NewRandomId generates a new unique random ID of specified length (default 8 chars)
 func NewRandomId(numChars ...int) (string, error) {
 	// Default to 8 characters if not specified
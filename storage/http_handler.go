@@ -0,0 +1,388 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	pj "google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Operation identifies the kind of request an EntityHandler is authorizing.
+type Operation string
+
+const (
+	OpList   Operation = "list"
+	OpGet    Operation = "get"
+	OpCreate Operation = "create"
+	OpUpdate Operation = "update"
+	OpDelete Operation = "delete"
+)
+
+// EntityHandler serves the entities in a FileStorage over HTTP as JSON.  The
+// main message of each entity (of type T) is stored in the MetadataName
+// artifact.  Routes are relative to where the handler is mounted (use
+// http.StripPrefix when mounting under a path):
+//
+//	GET    /            - List all entities
+//	POST   /            - Create an entity (optional ?id= for a custom id)
+//	GET    /{id}        - Get an entity
+//	PUT    /{id}        - Replace an entity
+//	DELETE /{id}        - Delete an entity and all its artifacts
+//	GET    /{id}/{name} - Get a named artifact
+//	PUT    /{id}/{name} - Create or replace a named artifact
+//	DELETE /{id}/{name} - Delete a named artifact
+//
+// Single resources are returned with an ETag and honor If-None-Match on reads
+// and If-Match on writes.
+type EntityHandler[T proto.Message] struct {
+	Storage *FileStorage
+
+	// Name of the artifact holding the entity itself.  Defaults to "metadata"
+	MetadataName string
+
+	// Other artifacts that can be accessed via /{id}/{name} along with a
+	// constructor for their message type.  Unlisted artifacts are not served.
+	Artifacts map[string]func() proto.Message
+
+	// Optional hook called before every operation.  Returning an error
+	// rejects the request with a 403.  id and artifact are empty when they do
+	// not apply to the operation.
+	Authorize func(r *http.Request, op Operation, id string, artifact string) error
+
+	// Maximum request body size.  Larger bodies are rejected with a 413.
+	// Defaults to DefaultEntityMaxBodyBytes
+	MaxBodyBytes int64
+
+	mux *http.ServeMux
+}
+
+// Default limit on the size of request bodies accepted by an EntityHandler
+const DefaultEntityMaxBodyBytes = 4 << 20
+
+// entityEnvelope is how entities are returned in lists and on creation.
+type entityEnvelope struct {
+	Id   string          `json:"id"`
+	Data json.RawMessage `json:"data"`
+}
+
+func NewEntityHandler[T proto.Message](storage *FileStorage) *EntityHandler[T] {
+	h := &EntityHandler[T]{
+		Storage:      storage,
+		MetadataName: "metadata",
+		Artifacts:    make(map[string]func() proto.Message),
+		mux:          http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /{$}", h.handleList)
+	h.mux.HandleFunc("POST /{$}", h.handleCreate)
+	h.mux.HandleFunc("GET /{id}", h.handleGet)
+	h.mux.HandleFunc("PUT /{id}", h.handlePut)
+	h.mux.HandleFunc("DELETE /{id}", h.handleDelete)
+	h.mux.HandleFunc("GET /{id}/{name}", h.handleGet)
+	h.mux.HandleFunc("PUT /{id}/{name}", h.handlePut)
+	h.mux.HandleFunc("DELETE /{id}/{name}", h.handleDelete)
+	return h
+}
+
+func (h *EntityHandler[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *EntityHandler[T]) handleList(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r, OpList, "", "") {
+		return
+	}
+	ids, err := h.Storage.ListEntityIds()
+	if err != nil {
+		writeJsonError(w, err)
+		return
+	}
+	out := []entityEnvelope{}
+	for _, id := range ids {
+		data, err := h.Storage.ReadArtifactFile(id, h.MetadataName)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("Failed to read %s for entity %s: %v", h.MetadataName, id, err)
+			}
+			continue
+		}
+		out = append(out, entityEnvelope{Id: id, Data: data})
+	}
+	writeJson(w, http.StatusOK, out)
+}
+
+func (h *EntityHandler[T]) handleCreate(w http.ResponseWriter, r *http.Request) {
+	customId := r.URL.Query().Get("id")
+	if !h.authorize(w, r, OpCreate, customId, "") {
+		return
+	}
+	if customId != "" {
+		if !validPathName(customId) {
+			writeJsonError(w, httpError(http.StatusBadRequest, "invalid entity id: %s", customId))
+			return
+		}
+	}
+	msg := newProtoInstance[T]()
+	if err := h.readProtoBody(w, r, msg); err != nil {
+		writeJsonError(w, err)
+		return
+	}
+
+	// The existence check and the first write are done under the storage
+	// lock so concurrent creates with the same id cannot both succeed
+	f := h.Storage
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if customId != "" {
+		if exists, _ := f.EntityExists(customId); exists {
+			writeJsonError(w, httpError(http.StatusConflict, "entity %s already exists", customId))
+			return
+		}
+	}
+	id, err := f.CreateEntity(customId)
+	if err == nil {
+		err = f.writeArtifact(id, h.MetadataName, msg, true)
+	}
+	if err != nil {
+		writeJsonError(w, err)
+		return
+	}
+	data, err := f.ReadArtifactFile(id, h.MetadataName)
+	if err != nil {
+		writeJsonError(w, err)
+		return
+	}
+	w.Header().Set("Location", id)
+	w.Header().Set("ETag", artifactETag(data))
+	writeJson(w, http.StatusCreated, entityEnvelope{Id: id, Data: data})
+}
+
+func (h *EntityHandler[T]) handleGet(w http.ResponseWriter, r *http.Request) {
+	id, name, ok := h.resolve(w, r, OpGet)
+	if !ok {
+		return
+	}
+	data, err := h.Storage.ReadArtifactFile(id, name)
+	if err != nil {
+		writeJsonError(w, err)
+		return
+	}
+	etag := artifactETag(data)
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (h *EntityHandler[T]) handlePut(w http.ResponseWriter, r *http.Request) {
+	id, name, ok := h.resolve(w, r, OpUpdate)
+	if !ok {
+		return
+	}
+	if exists, _ := h.Storage.EntityExists(id); !exists {
+		writeJsonError(w, httpError(http.StatusNotFound, "entity %s not found", id))
+		return
+	}
+	msg := h.newMessage(name)
+	if err := h.readProtoBody(w, r, msg); err != nil {
+		writeJsonError(w, err)
+		return
+	}
+
+	f := h.Storage
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := h.checkIfMatch(r, id, name); err != nil {
+		writeJsonError(w, err)
+		return
+	}
+	if err := f.writeArtifact(id, name, msg, true); err != nil {
+		writeJsonError(w, err)
+		return
+	}
+	data, err := f.ReadArtifactFile(id, name)
+	if err != nil {
+		writeJsonError(w, err)
+		return
+	}
+	w.Header().Set("ETag", artifactETag(data))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (h *EntityHandler[T]) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id, name, ok := h.resolve(w, r, OpDelete)
+	if !ok {
+		return
+	}
+
+	f := h.Storage
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := h.checkIfMatch(r, id, name); err != nil {
+		writeJsonError(w, err)
+		return
+	}
+	var err error
+	if r.PathValue("name") == "" {
+		err = f.DeleteEntity(id)
+	} else {
+		err = f.DeleteArtifact(id, name)
+	}
+	if err != nil {
+		writeJsonError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resolve extracts and validates the entity id and artifact name for a
+// request and runs the authorization hook.  Writes an error response and
+// returns false if the request should not proceed.
+func (h *EntityHandler[T]) resolve(w http.ResponseWriter, r *http.Request, op Operation) (id string, name string, ok bool) {
+	id = r.PathValue("id")
+	artifact := r.PathValue("name")
+	if !validPathName(id) {
+		writeJsonError(w, httpError(http.StatusBadRequest, "invalid entity id: %s", id))
+		return
+	}
+	if artifact != "" {
+		if _, found := h.Artifacts[artifact]; !found || !validPathName(artifact) {
+			writeJsonError(w, httpError(http.StatusNotFound, "artifact %s not found", artifact))
+			return
+		}
+	}
+	if !h.authorize(w, r, op, id, artifact) {
+		return
+	}
+	name = artifact
+	if name == "" {
+		name = h.MetadataName
+	}
+	return id, name, true
+}
+
+func (h *EntityHandler[T]) authorize(w http.ResponseWriter, r *http.Request, op Operation, id string, artifact string) bool {
+	if h.Authorize == nil {
+		return true
+	}
+	if err := h.Authorize(r, op, id, artifact); err != nil {
+		writeJsonError(w, httpError(http.StatusForbidden, "%s", err.Error()))
+		return false
+	}
+	return true
+}
+
+// checkIfMatch verifies the If-Match precondition (if any) against the
+// current artifact.  Must be called with the storage lock held.
+func (h *EntityHandler[T]) checkIfMatch(r *http.Request, id string, name string) error {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return nil
+	}
+	data, err := h.Storage.ReadArtifactFile(id, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return httpError(http.StatusPreconditionFailed, "artifact %s for entity %s does not exist", name, id)
+		}
+		return err
+	}
+	if !etagMatches(ifMatch, artifactETag(data)) {
+		return httpError(http.StatusPreconditionFailed, "artifact %s for entity %s has been modified", name, id)
+	}
+	return nil
+}
+
+func (h *EntityHandler[T]) newMessage(name string) proto.Message {
+	if name == h.MetadataName {
+		return newProtoInstance[T]()
+	}
+	return h.Artifacts[name]()
+}
+
+// statusError is an error carrying the HTTP status it should be reported with.
+type statusError struct {
+	status int
+	msg    string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+func httpError(status int, format string, args ...any) error {
+	return &statusError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+func writeJsonError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var se *statusError
+	if errors.As(err, &se) {
+		status = se.status
+	} else if errors.Is(err, os.ErrNotExist) {
+		status = http.StatusNotFound
+		err = errors.New("not found")
+	} else if errors.Is(err, ErrQuotaExceeded) {
+		status = http.StatusRequestEntityTooLarge
+	} else {
+		log.Printf("EntityHandler request failed: %v", err)
+	}
+	writeJson(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJson(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// readProtoBody decodes the (size limited) request body into m.
+func (h *EntityHandler[T]) readProtoBody(w http.ResponseWriter, r *http.Request, m proto.Message) error {
+	maxBytes := h.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultEntityMaxBodyBytes
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return httpError(http.StatusRequestEntityTooLarge, "request body exceeds %d bytes", tooLarge.Limit)
+		}
+		return httpError(http.StatusBadRequest, "failed to read request body: %v", err)
+	}
+	if err := pj.Unmarshal(body, m); err != nil {
+		return httpError(http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	return nil
+}
+
+func artifactETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches checks an If-Match/If-None-Match header value against an ETag.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
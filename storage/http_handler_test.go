@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func doRequest(t *testing.T, h http.Handler, method, path, body string, headers ...string) *http.Response {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	data, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	return string(data)
+}
+
+func TestEntityHandlerCrud(t *testing.T) {
+	h := NewEntityHandler[*structpb.Struct](NewFileStorage(t.TempDir()))
+	h.Artifacts["notes"] = func() proto.Message { return &wrapperspb.StringValue{} }
+
+	resp := doRequest(t, h, "POST", "/?id=e1", `{"title": "hello"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "e1", resp.Header.Get("Location"))
+
+	resp = doRequest(t, h, "POST", "/?id=e1", `{"title": "again"}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = doRequest(t, h, "POST", "/", `not json`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Get with etags
+	resp = doRequest(t, h, "GET", "/e1", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+	var got map[string]any
+	assert.Nil(t, json.Unmarshal([]byte(readBody(t, resp)), &got))
+	assert.Equal(t, "hello", got["title"])
+
+	resp = doRequest(t, h, "GET", "/e1", "", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	// Conditional updates
+	resp = doRequest(t, h, "PUT", "/e1", `{"title": "updated"}`, "If-Match", `"stale"`)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp = doRequest(t, h, "PUT", "/e1", `{"title": "updated"}`, "If-Match", etag)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+	resp = doRequest(t, h, "PUT", "/missing", `{"title": "updated"}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Named artifacts
+	resp = doRequest(t, h, "PUT", "/e1/notes", `"some notes"`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = doRequest(t, h, "GET", "/e1/notes", "")
+	assert.Equal(t, `"some notes"`, strings.TrimSpace(readBody(t, resp)))
+	resp = doRequest(t, h, "GET", "/e1/unknown", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = doRequest(t, h, "DELETE", "/e1/notes", "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = doRequest(t, h, "GET", "/e1/notes", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Listing
+	resp = doRequest(t, h, "POST", "/", `{"title": "second"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = doRequest(t, h, "GET", "/", "")
+	var listed []entityEnvelope
+	assert.Nil(t, json.Unmarshal([]byte(readBody(t, resp)), &listed))
+	assert.Equal(t, 2, len(listed))
+
+	resp = doRequest(t, h, "DELETE", "/e1", "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = doRequest(t, h, "GET", "/e1", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestEntityHandlerAuthorize(t *testing.T) {
+	h := NewEntityHandler[*structpb.Struct](NewFileStorage(t.TempDir()))
+	h.Authorize = func(r *http.Request, op Operation, id string, artifact string) error {
+		if op != OpGet && op != OpList && r.Header.Get("X-User") != "admin" {
+			return errors.New("only admins can modify entities")
+		}
+		return nil
+	}
+	resp := doRequest(t, h, "POST", "/", `{"title": "hello"}`)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = doRequest(t, h, "POST", "/?id=e1", `{"title": "hello"}`, "X-User", "admin")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = doRequest(t, h, "GET", "/e1", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = doRequest(t, h, "DELETE", "/e1", "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestEntityHandlerConcurrentCreate(t *testing.T) {
+	h := NewEntityHandler[*structpb.Struct](NewFileStorage(t.TempDir()))
+	var wg sync.WaitGroup
+	var created atomic.Int32
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := doRequest(t, h, "POST", "/?id=e1", fmt.Sprintf(`{"n": %d}`, i))
+			if resp.StatusCode == http.StatusCreated {
+				created.Add(1)
+			} else {
+				assert.Equal(t, http.StatusConflict, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), created.Load())
+}
+
+func TestEntityHandlerBodyLimit(t *testing.T) {
+	h := NewEntityHandler[*structpb.Struct](NewFileStorage(t.TempDir()))
+	h.MaxBodyBytes = 16
+	resp := doRequest(t, h, "POST", "/", `{"title": "a title longer than the limit"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	resp = doRequest(t, h, "POST", "/", `{"t": "ok"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+}
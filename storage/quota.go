@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrQuotaExceeded is matched (via errors.Is) by all QuotaErrors.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota sets the limits a FileStorage enforces on writes.  A zero value for
+// any of the limits means that limit is not enforced.
+type Quota struct {
+	// Maximum size in bytes of a single artifact
+	MaxArtifactSize int64
+
+	// Maximum number of artifacts in an entity
+	MaxArtifactsPerEntity int
+
+	// Maximum bytes across all artifacts in an entity
+	MaxEntityBytes int64
+
+	// Maximum bytes across all entities in the storage dir
+	MaxStorageBytes int64
+}
+
+// QuotaError is returned when a write would take an entity (or the storage
+// dir) beyond one of its configured limits.
+type QuotaError struct {
+	EntityId string
+	Artifact string
+
+	// Name of the limit that was hit, eg "MaxEntityBytes"
+	Limit string
+
+	// The configured limit and the value the write would have resulted in
+	Max       int64
+	Requested int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded for entity %s (artifact %s): %s is %d, write requires %d",
+		e.EntityId, e.Artifact, e.Limit, e.Max, e.Requested)
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// QuotaViolation returns the entity and the name of the limit that was hit
+// (for reporting the error as eg a gRPC QuotaFailure).
+func (e *QuotaError) QuotaViolation() (subject string, description string) {
+	return e.EntityId, e.Limit
+}
+
+// EntityUsage reports the storage used by a single entity.
+type EntityUsage struct {
+	EntityId      string
+	ArtifactCount int
+	TotalBytes    int64
+
+	// Size in bytes of each artifact by name
+	Artifacts map[string]int64
+}
+
+// WithQuota sets the limits enforced by the FileStorage on every save.
+func WithQuota(q Quota) FileStorageOption {
+	return func(f *FileStorage) {
+		f.quota = q
+	}
+}
+
+// Quota returns the limits currently enforced by this storage.
+func (f *FileStorage) Quota() Quota {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	return f.quota
+}
+
+// SetQuota changes the limits enforced on subsequent writes.  Existing data
+// that is already over the new limits is left untouched.
+func (f *FileStorage) SetQuota(q Quota) {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	f.quota = q
+}
+
+// Usage returns the number of artifacts and bytes used by an entity.
+func (f *FileStorage) Usage(id string) (*EntityUsage, error) {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	return f.entityUsage(id)
+}
+
+// StorageUsage returns the total bytes used by artifacts across all entities.
+func (f *FileStorage) StorageUsage() (int64, error) {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	if err := f.ensureStorageBytes(); err != nil {
+		return 0, err
+	}
+	return f.storageBytes, nil
+}
+
+// checkQuota ensures that writing size bytes to the given artifact keeps the
+// entity and storage dir within their limits.  Returns the change in the
+// total bytes stored if the write goes ahead.  Must be called with writeMu held.
+func (f *FileStorage) checkQuota(id string, name string, size int64) (delta int64, err error) {
+	usage, err := f.entityUsage(id)
+	if err != nil {
+		return 0, err
+	}
+	existing, exists := usage.Artifacts[name]
+	delta = size - existing
+
+	q := f.quota
+	newError := func(limit string, max int64, requested int64) error {
+		return &QuotaError{EntityId: id, Artifact: name, Limit: limit, Max: max, Requested: requested}
+	}
+	if q.MaxArtifactSize > 0 && size > q.MaxArtifactSize {
+		return 0, newError("MaxArtifactSize", q.MaxArtifactSize, size)
+	}
+	if q.MaxArtifactsPerEntity > 0 && !exists && usage.ArtifactCount+1 > q.MaxArtifactsPerEntity {
+		return 0, newError("MaxArtifactsPerEntity", int64(q.MaxArtifactsPerEntity), int64(usage.ArtifactCount+1))
+	}
+	if q.MaxEntityBytes > 0 && usage.TotalBytes+delta > q.MaxEntityBytes {
+		return 0, newError("MaxEntityBytes", q.MaxEntityBytes, usage.TotalBytes+delta)
+	}
+	if q.MaxStorageBytes > 0 {
+		if err := f.ensureStorageBytes(); err != nil {
+			return 0, err
+		}
+		if f.storageBytes+delta > q.MaxStorageBytes {
+			return 0, newError("MaxStorageBytes", q.MaxStorageBytes, f.storageBytes+delta)
+		}
+	}
+	return delta, nil
+}
+
+// recordUsage adjusts the running total of bytes in the storage dir.  Must be
+// called with writeMu held.
+func (f *FileStorage) recordUsage(delta int64) {
+	if f.storageKnown {
+		f.storageBytes += delta
+	}
+}
+
+// ensureStorageBytes scans the storage dir (once) to compute the total bytes
+// used by all entities.  Must be called with writeMu held.
+func (f *FileStorage) ensureStorageBytes() error {
+	if f.storageKnown {
+		return nil
+	}
+	entries, err := os.ReadDir(f.storageDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read storage directory: %w", err)
+	}
+	var total int64
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		usage, err := f.entityUsage(entry.Name())
+		if err != nil {
+			return err
+		}
+		total += usage.TotalBytes
+	}
+	f.storageBytes = total
+	f.storageKnown = true
+	return nil
+}
+
+// entityUsage computes the usage of an entity from the artifacts on disk.
+func (f *FileStorage) entityUsage(id string) (*EntityUsage, error) {
+	usage := &EntityUsage{EntityId: id, Artifacts: make(map[string]int64)}
+	entries, err := os.ReadDir(f.getEntityDir(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return usage, nil
+		}
+		return nil, fmt.Errorf("failed to read entity directory for %s: %w", id, err)
+	}
+	for _, entry := range entries {
+		name, ok := artifactName(entry.Name())
+		if entry.IsDir() || !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to stat artifact %s for entity %s: %w", name, id, err)
+		}
+		usage.Artifacts[name] = info.Size()
+		usage.ArtifactCount++
+		usage.TotalBytes += info.Size()
+	}
+	return usage, nil
+}
+
+// artifactName returns the artifact name for a file in an entity dir.
+// Temp files and internal files (prefixed with "_") are not artifacts.
+func artifactName(filename string) (string, bool) {
+	if filepath.Ext(filename) != ".json" || strings.HasPrefix(filename, "_") {
+		return "", false
+	}
+	return strings.TrimSuffix(filename, ".json"), true
+}
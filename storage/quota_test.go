@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestQuotaLimits(t *testing.T) {
+	fs := NewFileStorage(t.TempDir(), WithQuota(Quota{
+		MaxArtifactSize:       64,
+		MaxArtifactsPerEntity: 2,
+		MaxEntityBytes:        100,
+	}))
+
+	assert.Nil(t, fs.SaveArtifact("e1", "a", wrapperspb.String("hello")))
+	assert.Nil(t, fs.AtomicSaveArtifact("e1", "b", wrapperspb.String("world")))
+
+	// Too big for a single artifact
+	err := fs.SaveArtifact("e1", "a", wrapperspb.String(strings.Repeat("x", 100)))
+	assert.True(t, errors.Is(err, ErrQuotaExceeded))
+	var qe *QuotaError
+	assert.True(t, errors.As(err, &qe))
+	assert.Equal(t, "MaxArtifactSize", qe.Limit)
+
+	// Too many artifacts
+	err = fs.SaveArtifact("e1", "c", wrapperspb.String("third"))
+	assert.True(t, errors.As(err, &qe))
+	assert.Equal(t, "MaxArtifactsPerEntity", qe.Limit)
+
+	// Overwriting an existing artifact does not count as a new one
+	assert.Nil(t, fs.SaveArtifact("e1", "b", wrapperspb.String(strings.Repeat("y", 40))))
+
+	// But it does count towards entity bytes
+	err = fs.SaveArtifact("e1", "a", wrapperspb.String(strings.Repeat("z", 60)))
+	assert.True(t, errors.As(err, &qe))
+	assert.Equal(t, "MaxEntityBytes", qe.Limit)
+
+	usage, err := fs.Usage("e1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, usage.ArtifactCount)
+	assert.Equal(t, usage.Artifacts["a"]+usage.Artifacts["b"], usage.TotalBytes)
+
+	// Failed updates should leave the artifact untouched
+	var out wrapperspb.StringValue
+	assert.Nil(t, fs.LoadArtifact("e1", "a", &out))
+	assert.Equal(t, "hello", out.Value)
+}
+
+func TestStorageQuota(t *testing.T) {
+	dir := t.TempDir()
+	fs := NewFileStorage(dir)
+	assert.Nil(t, fs.SaveArtifact("e1", "metadata", wrapperspb.String(strings.Repeat("x", 40))))
+	used, err := fs.StorageUsage()
+	assert.Nil(t, err)
+
+	// Reopen with a storage wide limit so existing entities are accounted for
+	fs = NewFileStorage(dir, WithQuota(Quota{MaxStorageBytes: used + 20}))
+	err = fs.SaveArtifact("e2", "metadata", wrapperspb.String(strings.Repeat("y", 40)))
+	assert.True(t, errors.Is(err, ErrQuotaExceeded))
+
+	// Freeing up space allows the write
+	assert.Nil(t, fs.DeleteEntity("e1"))
+	assert.Nil(t, fs.SaveArtifact("e2", "metadata", wrapperspb.String(strings.Repeat("y", 40))))
+	used2, err := fs.StorageUsage()
+	assert.Nil(t, err)
+	assert.Equal(t, used, used2)
+}
+
+func TestInvalidArtifactNames(t *testing.T) {
+	fs := NewFileStorage(t.TempDir(), WithQuota(Quota{MaxStorageBytes: 1000}), WithEntityMeta())
+	assert.Nil(t, fs.SaveArtifact("e1", "metadata", wrapperspb.String("hello")))
+	used, err := fs.StorageUsage()
+	assert.Nil(t, err)
+
+	// Internal files and paths outside the entity cannot be written
+	for _, name := range []string{"", "_meta", "_search", ".hidden", "../e2/metadata", `a\b`} {
+		err := fs.SaveArtifact("e1", name, wrapperspb.String("x"))
+		assert.True(t, errors.Is(err, os.ErrInvalid), "%q", name)
+		assert.True(t, errors.Is(fs.DeleteArtifact("e1", name), os.ErrInvalid), "%q", name)
+	}
+	meta, err := fs.GetEntityMeta("e1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), meta.Revision)
+
+	// and the running total is unchanged
+	after, err := fs.StorageUsage()
+	assert.Nil(t, err)
+	assert.Equal(t, used, after)
+}
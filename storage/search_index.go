@@ -0,0 +1,454 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/panyam/goutils/utils"
+)
+
+// Name of the file (in each entity dir) the entity's index entries are
+// persisted to
+const searchIndexFile = "_search.json"
+
+// SearchIndexConfig controls what a FileStorage's search index covers.
+type SearchIndexConfig struct {
+	// Artifact whose fields are indexed.  Defaults to "metadata"
+	Artifact string
+
+	// Fields to index as "/" separated paths of proto field names, eg
+	// "title" or "details/description".  String and repeated string fields
+	// are supported.
+	Fields []string
+}
+
+// SearchResult is a single entity matching a search query.
+type SearchResult struct {
+	EntityId string
+	Score    float64
+}
+
+// WithSearchIndex enables an inverted index over the given string fields of
+// an artifact.  The index is updated as artifacts are saved and deleted and
+// is queried with FileStorage.Search.
+func WithSearchIndex(config SearchIndexConfig) FileStorageOption {
+	return func(f *FileStorage) {
+		if config.Artifact == "" {
+			config.Artifact = "metadata"
+		}
+		f.index = &searchIndex{storage: f, config: config}
+	}
+}
+
+// Search returns entities matching all the clauses in a query, best matches
+// first.  Clauses are separated by whitespace and can be:
+//
+//	term      - matches the term in any indexed field
+//	prefix*   - matches any term starting with prefix
+//	"a phrase" - matches the terms appearing consecutively in a field
+//
+// Phrases do not match across the elements of repeated fields.  A word that
+// splits into several terms (eg "e-mail") is matched as a phrase and a
+// trailing * applies to its last term.
+//
+// Matching is case insensitive.  A limit <= 0 returns all matches.
+func (f *FileStorage) Search(query string, limit int) ([]SearchResult, error) {
+	if f.index == nil {
+		return nil, fmt.Errorf("search index is not enabled")
+	}
+	return f.index.search(query, limit)
+}
+
+// RebuildSearchIndex discards the search index and rebuilds it from the
+// artifacts on disk.  Useful if the storage dir was modified externally.
+func (f *FileStorage) RebuildSearchIndex() error {
+	if f.index == nil {
+		return fmt.Errorf("search index is not enabled")
+	}
+	f.index.mu.Lock()
+	defer f.index.mu.Unlock()
+	return f.index.rebuild()
+}
+
+type searchIndex struct {
+	storage *FileStorage
+	config  SearchIndexConfig
+
+	mu     sync.Mutex
+	loaded bool
+
+	// Tokens of each indexed field by entity id.  Each entity's fields are
+	// persisted in its own dir so writes only touch that entity.  Elements of
+	// repeated fields are separated by searchGap tokens.
+	docs map[string]map[string][]string
+
+	// Term frequencies by term and entity id (derived from docs)
+	postings map[string]map[string]int
+}
+
+// update re-indexes an entity from the contents of its artifact.
+func (s *searchIndex) update(id string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensureLoaded(); err != nil {
+		log.Printf("Failed to load search index: %v", err)
+		return
+	}
+	s.removeDoc(id)
+	s.addDoc(id, s.extractFields(data))
+	if err := s.save(id); err != nil {
+		log.Printf("Failed to save search index: %v", err)
+	}
+}
+
+// remove drops an entity from the index.
+func (s *searchIndex) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensureLoaded(); err != nil {
+		log.Printf("Failed to load search index: %v", err)
+		return
+	}
+	if _, ok := s.docs[id]; !ok {
+		return
+	}
+	s.removeDoc(id)
+	if err := s.save(id); err != nil {
+		log.Printf("Failed to save search index: %v", err)
+	}
+}
+
+func (s *searchIndex) search(query string, limit int) ([]SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	clauses := parseSearchQuery(query)
+	if len(clauses) == 0 {
+		return nil, nil
+	}
+	var scores map[string]float64
+	for _, clause := range clauses {
+		clauseScores := s.matchClause(clause)
+		if scores == nil {
+			scores = clauseScores
+		} else {
+			// All clauses must match
+			for id, score := range scores {
+				if clauseScore, ok := clauseScores[id]; ok {
+					scores[id] = score + clauseScore
+				} else {
+					delete(scores, id)
+				}
+			}
+		}
+		if len(scores) == 0 {
+			return nil, nil
+		}
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, SearchResult{EntityId: id, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].EntityId < results[j].EntityId
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// searchClause is a single term, prefix or phrase in a query.  When prefix
+// is set the last term matches any term starting with it.
+type searchClause struct {
+	terms  []string
+	prefix bool
+}
+
+func parseSearchQuery(query string) (clauses []searchClause) {
+	for len(query) > 0 {
+		query = strings.TrimLeftFunc(query, unicode.IsSpace)
+		if query == "" {
+			break
+		}
+		var part string
+		prefix := false
+		if query[0] == '"' {
+			end := strings.IndexByte(query[1:], '"')
+			if end < 0 {
+				part, query = query[1:], ""
+			} else {
+				part, query = query[1:end+1], query[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(query, unicode.IsSpace)
+			if end < 0 {
+				end = len(query)
+			}
+			part, query = query[:end], query[end:]
+			prefix = strings.HasSuffix(part, "*")
+		}
+		// A single word can tokenize into several terms (eg "e-mail") in
+		// which case it is treated as a phrase
+		terms := tokenize(part)
+		if len(terms) > 0 {
+			clauses = append(clauses, searchClause{terms: terms, prefix: prefix})
+		}
+	}
+	return
+}
+
+// matchClause returns the score of every entity matching a clause.
+func (s *searchIndex) matchClause(clause searchClause) map[string]float64 {
+	scores := make(map[string]float64)
+	if clause.prefix && len(clause.terms) == 1 {
+		for term, entities := range s.postings {
+			if strings.HasPrefix(term, clause.terms[0]) {
+				s.addTermScores(scores, term, entities)
+			}
+		}
+	} else if len(clause.terms) == 1 {
+		term := clause.terms[0]
+		s.addTermScores(scores, term, s.postings[term])
+	} else {
+		var idf float64
+		for i, term := range clause.terms {
+			if !clause.prefix || i < len(clause.terms)-1 {
+				idf += s.idf(term)
+			}
+		}
+		// Only entities having the first term can contain the phrase
+		for id := range s.postings[clause.terms[0]] {
+			count := 0
+			for _, tokens := range s.docs[id] {
+				count += countPhrase(tokens, clause.terms, clause.prefix)
+			}
+			if count > 0 {
+				scores[id] = float64(count) * idf
+			}
+		}
+	}
+	return scores
+}
+
+func (s *searchIndex) addTermScores(scores map[string]float64, term string, entities map[string]int) {
+	idf := s.idf(term)
+	for id, tf := range entities {
+		scores[id] += float64(tf) * idf
+	}
+}
+
+func (s *searchIndex) idf(term string) float64 {
+	df := len(s.postings[term])
+	if df == 0 {
+		return 0
+	}
+	return math.Log(1 + float64(len(s.docs))/float64(df))
+}
+
+func countPhrase(tokens []string, phrase []string, prefix bool) (count int) {
+	last := len(phrase) - 1
+	for i := 0; i+len(phrase) <= len(tokens); i++ {
+		matched := true
+		for j, term := range phrase {
+			token := tokens[i+j]
+			if token != term && !(prefix && j == last && token != searchGap && strings.HasPrefix(token, term)) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			count++
+		}
+	}
+	return
+}
+
+func (s *searchIndex) addDoc(id string, fields map[string][]string) {
+	if len(fields) == 0 {
+		return
+	}
+	s.docs[id] = fields
+	for _, tokens := range fields {
+		for _, token := range tokens {
+			if token == searchGap {
+				continue
+			}
+			entities := s.postings[token]
+			if entities == nil {
+				entities = make(map[string]int)
+				s.postings[token] = entities
+			}
+			entities[id]++
+		}
+	}
+}
+
+func (s *searchIndex) removeDoc(id string) {
+	for _, tokens := range s.docs[id] {
+		for _, token := range tokens {
+			if entities := s.postings[token]; entities != nil {
+				delete(entities, id)
+				if len(entities) == 0 {
+					delete(s.postings, token)
+				}
+			}
+		}
+	}
+	delete(s.docs, id)
+}
+
+// Token placed between the elements of repeated fields so phrases do not
+// match across them.  tokenize never produces it.
+const searchGap = ""
+
+// extractFields tokenizes the configured fields from an artifact's JSON.
+func (s *searchIndex) extractFields(data []byte) map[string][]string {
+	var value map[string]any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil
+	}
+	out := make(map[string][]string)
+	for _, field := range s.config.Fields {
+		fieldValue, _ := utils.GetMapField(value, field)
+		var tokens []string
+		switch v := fieldValue.(type) {
+		case string:
+			tokens = tokenize(v)
+		case []any:
+			for _, item := range v {
+				if str, ok := item.(string); ok {
+					if itemTokens := tokenize(str); len(itemTokens) > 0 {
+						if len(tokens) > 0 {
+							tokens = append(tokens, searchGap)
+						}
+						tokens = append(tokens, itemTokens...)
+					}
+				}
+			}
+		}
+		if len(tokens) > 0 {
+			out[field] = tokens
+		}
+	}
+	return out
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ensureLoaded loads the persisted index entries of every entity.  Entities
+// without any (eg written before the index was enabled) are indexed from
+// their artifact.  Must be called with mu held.
+func (s *searchIndex) ensureLoaded() error {
+	if s.loaded {
+		return nil
+	}
+	ids, err := s.storage.ListEntityIds()
+	if err != nil {
+		return err
+	}
+	s.docs = make(map[string]map[string][]string)
+	s.postings = make(map[string]map[string]int)
+	for _, id := range ids {
+		data, err := os.ReadFile(s.indexPath(id))
+		if err == nil {
+			var fields map[string][]string
+			if err = json.Unmarshal(data, &fields); err == nil {
+				s.addDoc(id, fields)
+				continue
+			}
+			log.Printf("Search index for entity %s is corrupt, reindexing: %v", id, err)
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read search index for entity %s: %w", id, err)
+		}
+		if s.indexEntity(id) {
+			if err := s.save(id); err != nil {
+				return err
+			}
+		}
+	}
+	s.loaded = true
+	return nil
+}
+
+// rebuild indexes and persists the artifacts of all entities.  Must be
+// called with mu held.
+func (s *searchIndex) rebuild() error {
+	ids, err := s.storage.ListEntityIds()
+	if err != nil {
+		return err
+	}
+	s.docs = make(map[string]map[string][]string)
+	s.postings = make(map[string]map[string]int)
+	for _, id := range ids {
+		s.indexEntity(id)
+		if err := s.save(id); err != nil {
+			return err
+		}
+	}
+	s.loaded = true
+	return nil
+}
+
+// indexEntity adds an entity from its artifact on disk and returns whether
+// it had one.  Must be called with mu held.
+func (s *searchIndex) indexEntity(id string) bool {
+	data, err := s.storage.ReadArtifactFile(id, s.config.Artifact)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to index artifact (%s) for entity %s: %v", s.config.Artifact, id, err)
+		}
+		return false
+	}
+	s.addDoc(id, s.extractFields(data))
+	return true
+}
+
+// save persists the index entries of an entity, removing them if it has
+// none.  Must be called with mu held.
+func (s *searchIndex) save(id string) error {
+	indexPath := s.indexPath(id)
+	fields, ok := s.docs[id]
+	if !ok {
+		if err := os.Remove(indexPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	tmpPath := indexPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, indexPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+func (s *searchIndex) indexPath(id string) string {
+	return filepath.Join(s.storage.getEntityDir(id), searchIndexFile)
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func newSearchDoc(t *testing.T, fields map[string]any) *structpb.Struct {
+	s, err := structpb.NewStruct(fields)
+	assert.Nil(t, err)
+	return s
+}
+
+func searchIds(t *testing.T, fs *FileStorage, query string) (ids []string) {
+	results, err := fs.Search(query, 0)
+	assert.Nil(t, err)
+	for _, r := range results {
+		ids = append(ids, r.EntityId)
+	}
+	return
+}
+
+func TestSearchIndex(t *testing.T) {
+	dir := t.TempDir()
+	config := SearchIndexConfig{Fields: []string{"title", "info/description", "tags"}}
+	fs := NewFileStorage(dir, WithSearchIndex(config))
+
+	assert.Nil(t, fs.SaveArtifact("e1", "metadata", newSearchDoc(t, map[string]any{
+		"title": "Quick Brown Fox",
+		"info":  map[string]any{"description": "The fox jumps over the lazy dog"},
+	})))
+	assert.Nil(t, fs.SaveArtifact("e2", "metadata", newSearchDoc(t, map[string]any{
+		"title": "Lazy afternoons",
+		"tags":  []any{"dog", "sleep"},
+	})))
+	assert.Nil(t, fs.SaveArtifact("e3", "metadata", newSearchDoc(t, map[string]any{
+		"title": "Unindexed", "body": "fox fox fox",
+	})))
+	// Other artifacts are not indexed
+	assert.Nil(t, fs.SaveArtifact("e3", "notes", newSearchDoc(t, map[string]any{"title": "fox"})))
+
+	assert.Equal(t, []string{"e1"}, searchIds(t, fs, "FOX"))
+	assert.Equal(t, []string{"e1", "e2"}, searchIds(t, fs, "dog"))
+	assert.Equal(t, []string{"e2"}, searchIds(t, fs, "dog sleep"))
+	assert.Equal(t, []string{"e1", "e2"}, searchIds(t, fs, "laz*"))
+	assert.Equal(t, []string{"e1"}, searchIds(t, fs, `"lazy dog"`))
+	assert.Empty(t, searchIds(t, fs, `"dog lazy"`))
+	assert.Empty(t, searchIds(t, fs, "cat"))
+
+	// "fox" appears twice in e1 so it should outrank e2's single match
+	assert.Nil(t, fs.SaveArtifact("e2", "metadata", newSearchDoc(t, map[string]any{"title": "A fox"})))
+	assert.Equal(t, []string{"e1", "e2"}, searchIds(t, fs, "fox"))
+
+	// Updates and deletes are reflected
+	assert.Nil(t, fs.DeleteArtifact("e1", "metadata"))
+	assert.Equal(t, []string{"e2"}, searchIds(t, fs, "fox"))
+	assert.Nil(t, fs.DeleteEntity("e2"))
+	assert.Empty(t, searchIds(t, fs, "fox"))
+
+	// Index is persisted and can be rebuilt from scratch
+	assert.Nil(t, fs.SaveArtifact("e4", "metadata", newSearchDoc(t, map[string]any{"title": "Persistent fox"})))
+	fs2 := NewFileStorage(dir, WithSearchIndex(config))
+	assert.Equal(t, []string{"e4"}, searchIds(t, fs2, "persist*"))
+	assert.Nil(t, fs2.RebuildSearchIndex())
+	assert.Equal(t, []string{"e4"}, searchIds(t, fs2, "fox"))
+
+	results, err := fs2.Search("fox", 0)
+	assert.Nil(t, err)
+	assert.Greater(t, results[0].Score, 0.0)
+
+	_, err = NewFileStorage(t.TempDir()).Search("fox", 0)
+	assert.NotNil(t, err)
+}
+
+func TestSearchIndexPhrasesAndPrefixes(t *testing.T) {
+	dir := t.TempDir()
+	fs := NewFileStorage(dir, WithSearchIndex(SearchIndexConfig{Fields: []string{"title", "tags"}}))
+	assert.Nil(t, fs.SaveArtifact("e1", "metadata", newSearchDoc(t, map[string]any{
+		"title": "Sending e-mail reminders",
+		"tags":  []any{"red", "fox", "brown dog"},
+	})))
+
+	// Phrases do not span elements of repeated fields
+	assert.Empty(t, searchIds(t, fs, `"red fox"`))
+	assert.Equal(t, []string{"e1"}, searchIds(t, fs, `"brown dog"`))
+
+	// The prefix applies to the last term of a word split into several
+	assert.Equal(t, []string{"e1"}, searchIds(t, fs, "e-ma*"))
+	assert.Empty(t, searchIds(t, fs, "e-mx*"))
+
+	// Index entries are kept per entity
+	_, err := os.Stat(filepath.Join(dir, "e1", searchIndexFile))
+	assert.Nil(t, err)
+	assert.Nil(t, fs.DeleteArtifact("e1", "metadata"))
+	_, err = os.Stat(filepath.Join(dir, "e1", searchIndexFile))
+	assert.True(t, os.IsNotExist(err))
+}